@@ -0,0 +1,156 @@
+package byzantine
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+type Strategy string
+
+const (
+	Honest    Strategy = "honest"
+	AlwaysLie Strategy = "always-lie"
+	Random    Strategy = "random"
+	// Equivocate always answers the same value to the same peer
+	Equivocate Strategy = "equivocate"
+	// Silent does not answer with the silence probability
+	Silent Strategy = "silent"
+	// Balancing answers the less preferred of the two values the honest nodes prefer the most, it keeps the network split
+	Balancing Strategy = "balancing"
+)
+
+type Config struct {
+	Strategy           Strategy `json:"strategy" yaml:"strategy" toml:"strategy"`
+	Fraction           float64  `json:"fraction" yaml:"fraction" toml:"fraction"`
+	SilenceProbability float64  `json:"silence_probability" yaml:"silence_probability" toml:"silence_probability"`
+}
+
+func (c *Config) Verify() error {
+	switch c.Strategy {
+	case Honest, AlwaysLie, Random, Equivocate, Silent, Balancing:
+	default:
+		return fmt.Errorf("the byzantine strategy %s is unknown", c.Strategy)
+	}
+	switch {
+	case c.Fraction < 0 || c.Fraction >= 1:
+		return fmt.Errorf("fraction = %v: fails the condition that: 0 <= fraction < 1", c.Fraction)
+	case c.SilenceProbability < 0 || c.SilenceProbability > 1:
+		return fmt.Errorf("silenceProbability = %v: fails the condition that: 0 <= silenceProbability <= 1", c.SilenceProbability)
+	}
+	return nil
+}
+
+func (c *Config) NumOfNodes(n int) int {
+	if c.Strategy == Honest {
+		return 0
+	}
+	return int(math.Round(c.Fraction * float64(n)))
+}
+
+// View lets the nodes of a balancing attack see how many honest nodes prefer every value of a block
+type View func(index int) map[byte]int
+
+type Byzantine struct {
+	cfg Config
+	// preferences is the number of possible values of a block
+	preferences int
+	rand        *rand.Rand
+	view        View
+}
+
+// New answers values in [0, preferences), the view is only needed by the Balancing strategy
+func New(cfg Config, preferences int, r *rand.Rand, view View) (*Byzantine, error) {
+	err := cfg.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if preferences <= 0 {
+		return nil, fmt.Errorf("preferences = %d: fails the condition that: 0 < preferences", preferences)
+	}
+	if cfg.Strategy == Balancing && view == nil {
+		return nil, fmt.Errorf("the %s strategy needs a view of the honest nodes", Balancing)
+	}
+	return &Byzantine{
+		cfg:         cfg,
+		preferences: preferences,
+		rand:        r,
+		view:        view,
+	}, nil
+}
+
+func (b *Byzantine) Strategy() Strategy {
+	return b.cfg.Strategy
+}
+
+// RespondData answers the value of the block in the first byte of the data, the node does not answer when it returns false
+func (b *Byzantine) RespondData(from string, index int, data []byte) ([]byte, bool) {
+	if len(data) == 0 {
+		return data, true
+	}
+	value := int(data[0])
+	switch b.cfg.Strategy {
+	case AlwaysLie:
+		value = (value + 1) % b.preferences
+	case Random:
+		value = b.rand.Intn(b.preferences)
+	case Equivocate:
+		value = int(hash(from) % uint32(b.preferences))
+	case Silent:
+		if b.silent() {
+			return nil, false
+		}
+	case Balancing:
+		value = b.balance(index, value)
+	}
+	answer := make([]byte, len(data))
+	copy(answer, data)
+	answer[0] = byte(value)
+	return answer, true
+}
+
+// RespondChit has no view of the vertices, Balancing splits the peers in two halves getting opposite chits
+func (b *Byzantine) RespondChit(from string, chit bool) (bool, bool) {
+	switch b.cfg.Strategy {
+	case AlwaysLie:
+		return !chit, true
+	case Random:
+		return b.rand.Intn(2) == 0, true
+	case Equivocate, Balancing:
+		return hash(from)%2 == 0, true
+	case Silent:
+		if b.silent() {
+			return false, false
+		}
+	}
+	return chit, true
+}
+
+func (b *Byzantine) silent() bool {
+	return b.rand.Float64() < b.cfg.SilenceProbability
+}
+
+func (b *Byzantine) balance(index int, value int) int {
+	counts := b.view(index)
+	first, second := -1, -1
+	for v := 0; v < b.preferences; v++ {
+		count := counts[byte(v)]
+		switch {
+		case first == -1 || count > counts[byte(first)]:
+			first, second = v, first
+		case second == -1 || count > counts[byte(second)]:
+			second = v
+		}
+	}
+	if second == -1 {
+		return value
+	}
+	return second
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -2,36 +2,60 @@ package chain
 
 import (
 	"context"
-	"encoding/json"
 	"github.com/pkg/errors"
 	"github.com/tiennampham23/avalanche-consensus-simulator/model"
 	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
 	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/validators"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"math/rand"
 )
 
+var tracer = otel.Tracer("github.com/tiennampham23/avalanche-consensus-simulator/chain")
+
 type Config struct {
 	P2PConfig           p2p.Config
 	ConsensusParameters consensus.Parameters
+	// Concurrency is capped by MaxOutstandingItems, the blocks are decided one after another when it is 0 or 1
+	Concurrency int
+	Seed        int64
+	// nothing is recorded when Recorder is nil
+	Recorder *report.NodeRecorder
+	// the chain is kept in memory when Storage is nil
+	Storage Storage
 }
 
 type BlockChain struct {
 	*BlockChainState
 	client    *p2p.Client
 	cfg       Config
+	rand      *rand.Rand
 	isRunning bool
 }
 
-func InitBlockChain(ctx context.Context, cfg Config, discovery *p2p.Discovery) (*BlockChain, error) {
+func InitBlockChain(ctx context.Context, cfg Config, routers ...p2p.Router) (*BlockChain, error) {
 	blockChainState := InitBlockChainState()
+	if cfg.Storage != nil {
+		var err error
+		blockChainState, err = LoadBlockChainState(cfg.Storage)
+		if err != nil {
+			return nil, err
+		}
+	}
 	blockchain := &BlockChain{
 		BlockChainState: blockChainState,
 		cfg:             cfg,
+		rand:            random.New(cfg.Seed),
 	}
 	getDataFromBlockIndexCb := func(index int) ([]byte, error) {
 		return blockchain.getBlockDataByIndex(index)
 	}
-	client, err := p2p.InitClient(ctx, cfg.P2PConfig, discovery, getDataFromBlockIndexCb)
+	client, err := p2p.InitClient(ctx, cfg.P2PConfig, getDataFromBlockIndexCb, routers...)
 	if err != nil {
 		return nil, err
 	}
@@ -40,55 +64,102 @@ func InitBlockChain(ctx context.Context, cfg Config, discovery *p2p.Discovery) (
 	return blockchain, nil
 }
 
+func (c *BlockChain) Client() *p2p.Client {
+	return c.client
+}
+
 func (c *BlockChain) Sync(ctx context.Context) error {
 	if c.isRunning {
 		return nil
 	}
 
 	c.isRunning = true
+	defer func() {
+		c.isRunning = false
+	}()
+	ctx, span := tracer.Start(ctx, "BlockChain.Sync", trace.WithAttributes(
+		attribute.String("node.address", c.client.Transport().Address()),
+		attribute.Int("chain.blocks", len(c.Blocks)),
+	))
+	defer span.End()
+	if c.cfg.Concurrency > 1 {
+		return c.syncConcurrently(ctx)
+	}
+	var parent consensus.Consensus
 	for i, block := range c.Blocks {
-		snowBallConsensus, err := consensus.NewConsensus(
+		// a block decided before a restart is final, the next block does not wait for it
+		if c.Decided(i) {
+			parent = nil
+			continue
+		}
+		blockConsensus, err := consensus.NewConsensus(
 			c.cfg.ConsensusParameters,
 			block.Data,
+			parent,
 		)
 		if err != nil {
 			return err
 		}
-		getBlockDataFromRandomKCb := func(k int) ([][]byte, error) {
+		blockConsensus = c.observe(i, blockConsensus)
+		getBlockDataFromRandomKCb := func(ctx context.Context, k int) ([][]byte, error) {
 			return c.getBlockDataFromKPeersByIndex(ctx, i, k)
 		}
 		setDataCb := func(data []byte) error {
-			return block.SetData(data)
+			return c.SetData(i, data)
 		}
-		err = snowBallConsensus.Sync(ctx, setDataCb, getBlockDataFromRandomKCb)
+		err = consensus.Sync(ctx, blockConsensus, setDataCb, getBlockDataFromRandomKCb)
 		if err != nil {
 			return errors.Wrap(err, "unable to sync the consensus")
 		}
+		err = c.Decide(i)
+		if err != nil {
+			return err
+		}
+		parent = blockConsensus
 	}
-
-	c.isRunning = false
 	return nil
 }
 
+func (c *BlockChain) observe(index int, blockConsensus consensus.Consensus) consensus.Consensus {
+	return c.client.Metrics().Observe(c.cfg.Recorder.Observe(index, blockConsensus))
+}
+
 func (c *BlockChain) getBlockDataFromKPeersByIndex(ctx context.Context, index int, k int) ([][]byte, error) {
+	c.client.Metrics().PollIssued()
+	ctx, span := tracer.Start(ctx, "BlockChain.getBlockDataFromKPeersByIndex", trace.WithAttributes(
+		attribute.Int("chain.index", index),
+		attribute.Int("consensus.k", k),
+	))
+	defer span.End()
 	peers, err := c.client.Peers()
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "unable to get the peers")
 		return nil, errors.Wrap(err, "unable to get the peers from the discovery")
 	}
-	lengthPeers := len(peers)
+	failed := 0
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("p2p.peers", len(peers)),
+			attribute.Int("p2p.failed_requests", failed),
+		)
+	}()
 	var preferencesFromOtherPeers [][]byte
+	var weights []uint64
 
 	var count int
-	for _, i := range rand.Perm(lengthPeers) {
+	for _, i := range validators.SamplePeers(c.rand, peers) {
 		randomPeer := peers[i]
 		if randomPeer == nil {
 			continue
 		}
 		preference, err := c.getDataFromOtherPeerByIndex(ctx, randomPeer, index)
 		if err != nil || len(preference) == 0 {
+			failed++
 			continue
 		}
 		preferencesFromOtherPeers = append(preferencesFromOtherPeers, preference)
+		weights = append(weights, randomPeer.Weight)
 
 		count++
 		// get the preferences of the k random peers from the peers
@@ -96,6 +167,9 @@ func (c *BlockChain) getBlockDataFromKPeersByIndex(ctx context.Context, index in
 			break
 		}
 	}
+	if c.cfg.ConsensusParameters.StakeAlpha {
+		return consensus.WeighPoll(preferencesFromOtherPeers, weights), nil
+	}
 	return preferencesFromOtherPeers, nil
 }
 func (c *BlockChain) getDataFromOtherPeerByIndex(ctx context.Context, peer *p2p.Peer, index int) ([]byte, error) {
@@ -114,7 +188,13 @@ func (c *BlockChain) getDataFromOtherPeerByIndex(ctx context.Context, peer *p2p.
 	return blockDataResponse, nil
 }
 
+func (c *BlockChain) BlockData(index int) ([]byte, error) {
+	return c.getBlockDataByIndex(index)
+}
+
 func (c *BlockChain) getBlockDataByIndex(index int) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if index < 0 {
 		return nil, errors.New("Index is smaller than 0")
 	}
@@ -124,10 +204,5 @@ func (c *BlockChain) getBlockDataByIndex(index int) ([]byte, error) {
 
 	block := c.Blocks[index]
 
-	b, err := json.Marshal(block.Data)
-	if err != nil {
-		return nil, err
-	}
-
-	return b, nil
+	return block.Data, nil
 }
@@ -0,0 +1,251 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/model"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/validators"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sort"
+	"sync"
+)
+
+type blockPoll struct {
+	index int
+	// order is the sample, the poll takes the first k peers that answer
+	order       []int
+	next        int
+	answers     map[int]blockAnswer
+	preferences [][]byte
+	weights     []uint64
+}
+
+type blockAnswer struct {
+	preference []byte
+	weight     uint64
+}
+
+type pollQuery struct {
+	poll     *blockPoll
+	position int
+}
+
+type blockDecision struct {
+	index     int
+	consensus consensus.Consensus
+}
+
+func (c *BlockChain) syncConcurrently(ctx context.Context) error {
+	parameters := c.cfg.ConsensusParameters
+	concurrency := c.cfg.Concurrency
+	if concurrency > parameters.MaxOutstandingItems {
+		concurrency = parameters.MaxOutstandingItems
+	}
+	// a peer is asked for every processing block in a single request
+	if concurrency > p2p.MaxIndices {
+		concurrency = p2p.MaxIndices
+	}
+
+	processing := make([]*blockDecision, 0, concurrency)
+	var parent consensus.Consensus
+	next := 0
+	// a finalized block is only decided once every block before it is, an earlier block may still rehash it
+	finalized := make(map[int]bool)
+	undecided := 0
+	for next < len(c.Blocks) || len(processing) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		for ; next < len(c.Blocks) && len(processing) < concurrency; next++ {
+			if c.Decided(next) {
+				parent = nil
+				continue
+			}
+			block := c.Blocks[next]
+			blockConsensus, err := consensus.NewConsensus(parameters, block.Data, parent)
+			if err != nil {
+				return err
+			}
+			blockConsensus = c.observe(next, blockConsensus)
+			processing = append(processing, &blockDecision{
+				index:     next,
+				consensus: blockConsensus,
+			})
+			parent = blockConsensus
+		}
+
+		polls, err := c.pollBlocks(ctx, processing)
+		if err != nil {
+			return errors.Wrap(err, "unable to poll the blocks")
+		}
+		for i, decision := range processing {
+			oldPreference := decision.consensus.Preference()
+			for _, poll := range polls[i] {
+				if len(poll.preferences) < parameters.K || decision.consensus.Finalized() {
+					continue
+				}
+				preferences := poll.preferences
+				if parameters.StakeAlpha {
+					preferences = consensus.WeighPoll(preferences, poll.weights)
+				}
+				err := decision.consensus.RecordPoll(preferences)
+				if err != nil {
+					return errors.Wrap(err, "unable to record the poll")
+				}
+			}
+			if bytes.Equal(oldPreference, decision.consensus.Preference()) {
+				continue
+			}
+			err := c.SetData(decision.index, decision.consensus.Preference())
+			if err != nil {
+				return errors.Wrap(err, "unable to update the preference")
+			}
+		}
+
+		stillProcessing := processing[:0]
+		for _, decision := range processing {
+			if !decision.consensus.Finalized() {
+				stillProcessing = append(stillProcessing, decision)
+				continue
+			}
+			finalized[decision.index] = true
+		}
+		processing = stillProcessing
+		for ; undecided < next && (finalized[undecided] || c.Decided(undecided)); undecided++ {
+			if !finalized[undecided] {
+				continue
+			}
+			err := c.Decide(undecided)
+			if err != nil {
+				return err
+			}
+			delete(finalized, undecided)
+		}
+	}
+	return nil
+}
+
+// pollBlocks replaces a peer that does not answer by the next peer of the sample until k peers answer
+func (c *BlockChain) pollBlocks(ctx context.Context, decisions []*blockDecision) ([][]*blockPoll, error) {
+	indices := make([]int, 0, len(decisions))
+	for _, decision := range decisions {
+		indices = append(indices, decision.index)
+	}
+	ctx, span := tracer.Start(ctx, "BlockChain.pollBlocks", trace.WithAttributes(attribute.IntSlice("chain.indices", indices)))
+	defer span.End()
+	peers, err := c.client.Peers()
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "unable to get the peers")
+		return nil, errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	span.SetAttributes(attribute.Int("p2p.peers", len(peers)))
+	parameters := c.cfg.ConsensusParameters
+
+	polls := make([][]*blockPoll, len(decisions))
+	for i, decision := range decisions {
+		for r := 0; r < parameters.Repolls(); r++ {
+			polls[i] = append(polls[i], &blockPoll{
+				index:   decision.index,
+				order:   validators.SamplePeers(c.rand, peers),
+				answers: make(map[int]blockAnswer),
+			})
+			c.client.Metrics().PollIssued()
+		}
+	}
+
+	waves := 0
+	for {
+		queries := make(map[*p2p.Peer][]pollQuery)
+		for _, blockPolls := range polls {
+			for _, poll := range blockPolls {
+				for missing := parameters.K - len(poll.answers); missing > 0 && poll.next < len(poll.order); poll.next++ {
+					peer := peers[poll.order[poll.next]]
+					if peer == nil {
+						continue
+					}
+					queries[peer] = append(queries[peer], pollQuery{
+						poll:     poll,
+						position: poll.next,
+					})
+					missing--
+				}
+			}
+		}
+		if len(queries) == 0 {
+			break
+		}
+		waves++
+		c.query(ctx, queries)
+	}
+	span.SetAttributes(attribute.Int("chain.waves", waves))
+
+	for _, blockPolls := range polls {
+		for _, poll := range blockPolls {
+			positions := make([]int, 0, len(poll.answers))
+			for position := range poll.answers {
+				positions = append(positions, position)
+			}
+			sort.Ints(positions)
+			for _, position := range positions {
+				poll.preferences = append(poll.preferences, poll.answers[position].preference)
+				poll.weights = append(poll.weights, poll.answers[position].weight)
+			}
+		}
+	}
+	return polls, nil
+}
+
+func (c *BlockChain) query(ctx context.Context, queries map[*p2p.Peer][]pollQuery) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for peer, peerQueries := range queries {
+		wg.Add(1)
+		go func(peer *p2p.Peer, peerQueries []pollQuery) {
+			defer wg.Done()
+			indices := make([]int, 0, len(peerQueries))
+			for _, q := range peerQueries {
+				indices = append(indices, q.poll.index)
+			}
+			data := c.getDataFromOtherPeerByIndices(ctx, peer, indices)
+			mu.Lock()
+			defer mu.Unlock()
+			for _, q := range peerQueries {
+				preference, ok := data[q.poll.index]
+				if !ok || len(preference) == 0 {
+					continue
+				}
+				q.poll.answers[q.position] = blockAnswer{
+					preference: preference,
+					weight:     peer.Weight,
+				}
+			}
+		}(peer, peerQueries)
+	}
+	wg.Wait()
+}
+
+func (c *BlockChain) getDataFromOtherPeerByIndices(ctx context.Context, peer *p2p.Peer, indices []int) map[int][]byte {
+	seen := make(map[int]bool, len(indices))
+	req := model.GetBlockDataByIndicesRequest{
+		Indices: make([]int, 0, len(indices)),
+	}
+	for _, index := range indices {
+		if !seen[index] {
+			seen[index] = true
+			req.Indices = append(req.Indices, index)
+		}
+	}
+	blocksData, err := c.client.GetBlocksData(ctx, peer, req)
+	if err != nil {
+		return nil
+	}
+	return blocksData
+}
@@ -0,0 +1,233 @@
+package chain
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+const (
+	testNodes  = 10
+	testBlocks = 12
+	// silentNode never answers the queries of its peers
+	silentNode = testNodes - 1
+)
+
+var testParameters = consensus.Parameters{
+	K:                   5,
+	Alpha:               4,
+	BetaVirtuous:        3,
+	BetaRogue:           5,
+	ConcurrentRepolls:   2,
+	MaxOutstandingItems: 64,
+}
+
+// startChains starts the last contested nodes with 'b' for every block and the others with 'a'
+func startChains(t *testing.T, ctx context.Context, concurrency, contested int, seed int64) []*BlockChain {
+	t.Helper()
+	network := p2p.NewMemoryNetwork()
+	discovery := p2p.InitDiscovery(network.NewTransport("discovery"))
+	if err := discovery.Start(); err != nil {
+		t.Fatal(err)
+	}
+	chains := make([]*BlockChain, testNodes)
+	for j := range chains {
+		p2pConfig := p2p.Config{
+			DiscoveryAddress: discovery.Address,
+			Transport:        network.NewTransport(fmt.Sprintf("node-%d", j)),
+		}
+		if j == silentNode {
+			p2pConfig.Responder = func(string, int, []byte) ([]byte, bool) {
+				return nil, false
+			}
+		}
+		c, err := InitBlockChain(ctx, Config{
+			P2PConfig:           p2pConfig,
+			ConsensusParameters: testParameters,
+			Concurrency:         concurrency,
+			Seed:                seed + int64(j),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = c.Client().Close()
+		})
+		value := byte('a')
+		if j >= testNodes-contested {
+			value = 'b'
+		}
+		for i := 0; i < testBlocks; i++ {
+			if err := c.Add(NewBlock(c.LastBlock(), []byte{value, byte(i)}, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chains[j] = c
+	}
+	return chains
+}
+
+func syncChains(t *testing.T, ctx context.Context, chains []*BlockChain) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make([]error, len(chains))
+	for j, c := range chains[:silentNode] {
+		wg.Add(1)
+		go func(j int, c *BlockChain) {
+			defer wg.Done()
+			errs[j] = c.Sync(ctx)
+		}(j, c)
+	}
+	wg.Wait()
+	for j, err := range errs {
+		if err != nil {
+			t.Fatalf("node %d: %v", j, err)
+		}
+	}
+}
+
+func TestPollBlocksReplacesSilentPeers(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	chains := startChains(t, ctx, 4, 3, 1)
+	decisions := make([]*blockDecision, 0, testBlocks)
+	for i := 0; i < testBlocks; i++ {
+		decisions = append(decisions, &blockDecision{index: i})
+	}
+	polls, err := chains[0].pollBlocks(ctx, decisions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, blockPolls := range polls {
+		for _, poll := range blockPolls {
+			if len(poll.preferences) != testParameters.K {
+				t.Errorf("block %d: the poll got %d answers, want %d", i, len(poll.preferences), testParameters.K)
+			}
+		}
+	}
+}
+
+func TestSyncConcurrentlyMatchesSequentialSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	sequential := startChains(t, ctx, 1, 3, 1)
+	concurrent := startChains(t, ctx, 4, 3, 1)
+	syncChains(t, ctx, sequential)
+	syncChains(t, ctx, concurrent)
+
+	want := sequential[0].Blocks
+	for _, chains := range [][]*BlockChain{sequential, concurrent} {
+		for j, c := range chains[:silentNode] {
+			if err := c.Verify(); err != nil {
+				t.Fatalf("node %d: %v", j, err)
+			}
+			for i, block := range c.Blocks {
+				if !bytes.Equal(block.Data, want[i].Data) || block.BlockHash != want[i].BlockHash {
+					t.Errorf("node %d, concurrency %d: block %d is %q, want %q", j, c.cfg.Concurrency, i, block.Data, want[i].Data)
+				}
+			}
+		}
+	}
+}
+
+func TestSyncSkipsDecidedBlocks(t *testing.T) {
+	for _, concurrency := range []int{1, 4} {
+		t.Run(fmt.Sprintf("concurrency=%d", concurrency), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			chains := startChains(t, ctx, concurrency, 3, 1)
+			// a node holding 'b' decided the first half of the blocks before a restart, the majority holds 'a'
+			c := chains[testNodes-2]
+			for i := 0; i < testBlocks/2; i++ {
+				if err := c.Decide(i); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := c.Sync(ctx); err != nil {
+				t.Fatal(err)
+			}
+			for i, block := range c.Blocks {
+				want := byte('a')
+				if i < testBlocks/2 {
+					want = 'b'
+				}
+				if block.Data[0] != want {
+					t.Errorf("block %d is %q, want %q", i, block.Data[0], want)
+				}
+				if !c.Decided(i) {
+					t.Errorf("block %d is not decided", i)
+				}
+			}
+		})
+	}
+}
+
+func TestSyncAgreesOnContestedBlocks(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			// the answering nodes are split 5 to 4 between 'a' and 'b'
+			sequential := startChains(t, ctx, 1, testNodes/2, seed)
+			concurrent := startChains(t, ctx, 4, testNodes/2, seed)
+			syncChains(t, ctx, sequential)
+			syncChains(t, ctx, concurrent)
+
+			// a contested block may be decided either way, but every node of a sync decides it the same way
+			for _, chains := range [][]*BlockChain{sequential, concurrent} {
+				want := chains[0]
+				for j, c := range chains[:silentNode] {
+					if err := c.Verify(); err != nil {
+						t.Fatalf("node %d: %v", j, err)
+					}
+					for i, block := range c.Blocks {
+						if !bytes.Equal(block.Data, want.Blocks[i].Data) || block.BlockHash != want.Blocks[i].BlockHash {
+							t.Errorf("node %d, concurrency %d: block %d is %q, want %q", j, c.cfg.Concurrency, i, block.Data, want.Blocks[i].Data)
+						}
+						if !c.Decided(i) {
+							t.Errorf("node %d, concurrency %d: block %d is not decided", j, c.cfg.Concurrency, i)
+						}
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSetDataRefusesToRehashDecidedBlocks(t *testing.T) {
+	c := InitBlockChainState()
+	for i := 0; i < 4; i++ {
+		if err := c.Add(NewBlock(c.LastBlock(), []byte{'a', byte(i)}, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Decide(2); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		index int
+		valid bool
+	}{
+		{index: 0},
+		{index: 2},
+		{index: 3, valid: true},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("index=%d", tt.index), func(t *testing.T) {
+			hash := c.Blocks[2].BlockHash
+			err := c.SetData(tt.index, []byte("b"))
+			if (err == nil) != tt.valid {
+				t.Errorf("SetData() = %v, want valid = %v", err, tt.valid)
+			}
+			if c.Blocks[2].BlockHash != hash {
+				t.Error("the decided block was rehashed")
+			}
+		})
+	}
+}
@@ -1,36 +1,245 @@
 package chain
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/pkg/errors"
 	"sync"
 )
 
 type Block struct {
-	Data      []byte `json:"data"`
-	BlockHash string `json:"blockHash"`
-	BlockTime int64  `json:"blockTime"`
+	Height uint64 `json:"height"`
+	// ParentHash is empty for the first block of the chain
+	ParentHash string `json:"parentHash"`
+	Data       []byte `json:"data"`
+	BlockHash  string `json:"blockHash"`
+	BlockTime  int64  `json:"blockTime"`
 }
 
-func (b *Block) SetData(data []byte) error {
-	b.Data = data
+// NewBlock creates the first block of the chain when the parent is nil
+func NewBlock(parent *Block, data []byte, blockTime int64) *Block {
+	b := &Block{
+		Data:      data,
+		BlockTime: blockTime,
+	}
+	if parent != nil {
+		b.Height = parent.Height + 1
+		b.ParentHash = parent.BlockHash
+	}
+	b.BlockHash = b.Hash()
+	return b
+}
+
+// Encode writes 32 zero bytes as the parent hash of the first block
+func (b *Block) Encode() ([]byte, error) {
+	parentHash := make([]byte, sha256.Size)
+	if b.ParentHash != "" {
+		decoded, err := hex.DecodeString(b.ParentHash)
+		if err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("the parent hash %q is not a hex encoded sha256 hash", b.ParentHash)
+		}
+		parentHash = decoded
+	}
+	var buf bytes.Buffer
+	_ = binary.Write(&buf, binary.BigEndian, b.Height)
+	buf.Write(parentHash)
+	_ = binary.Write(&buf, binary.BigEndian, b.BlockTime)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(b.Data)))
+	buf.Write(b.Data)
+	return buf.Bytes(), nil
+}
+
+// Hash is empty if the block cannot be encoded
+func (b *Block) Hash() string {
+	encoded, err := b.Encode()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify takes a nil parent for the first block of the chain
+func (b *Block) Verify(parent *Block) error {
+	if parent == nil {
+		if b.Height != 0 || b.ParentHash != "" {
+			return fmt.Errorf("height = %d, parentHash = %q: fails the condition that: the first block has the height 0 and no parent", b.Height, b.ParentHash)
+		}
+	} else {
+		if b.Height != parent.Height+1 {
+			return fmt.Errorf("height = %d, parent height = %d: fails the condition that: height = parent height + 1", b.Height, parent.Height)
+		}
+		if b.ParentHash != parent.BlockHash {
+			return fmt.Errorf("the parent hash %s is not the hash %s of the last block", b.ParentHash, parent.BlockHash)
+		}
+	}
+	hash := b.Hash()
+	if hash == "" || b.BlockHash != hash {
+		return fmt.Errorf("the block hash %s does not match the content of the block", b.BlockHash)
+	}
 	return nil
 }
 
 type BlockChainState struct {
 	Blocks []*Block
 	mu     sync.Mutex
+	// decided are not decided again after a restart
+	decided map[uint64]bool
+	storage Storage
 }
 
 func InitBlockChainState() *BlockChainState {
 	blocks := make([]*Block, 0)
 	return &BlockChainState{
-		Blocks: blocks,
+		Blocks:  blocks,
+		decided: make(map[uint64]bool),
+		storage: NewMemoryStorage(),
 	}
 }
 
+func LoadBlockChainState(storage Storage) (*BlockChainState, error) {
+	blocks, err := storage.Blocks()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the blocks of the storage")
+	}
+	heights, err := storage.Decided()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the decided heights of the storage")
+	}
+	c := &BlockChainState{
+		Blocks:  blocks,
+		decided: make(map[uint64]bool),
+		storage: storage,
+	}
+	for _, height := range heights {
+		c.decided[height] = true
+	}
+	err = c.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "the stored chain is broken")
+	}
+	return c, nil
+}
+
 func (c *BlockChainState) Add(newBlock *Block) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	err := newBlock.Verify(c.lastBlock())
+	if err != nil {
+		return errors.Wrap(err, "invalid block")
+	}
+	err = c.storage.Put(newBlock)
+	if err != nil {
+		return errors.Wrap(err, "unable to store the block")
+	}
 	c.Blocks = append(c.Blocks, newBlock)
 
 	return nil
 }
+
+// LastBlock is nil when the chain is empty
+func (c *BlockChainState) LastBlock() *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastBlock()
+}
+
+func (c *BlockChainState) Block(height uint64) (*Block, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if height >= uint64(len(c.Blocks)) {
+		return nil, false
+	}
+	return c.Blocks[height], true
+}
+
+func (c *BlockChainState) lastBlock() *Block {
+	if len(c.Blocks) == 0 {
+		return nil
+	}
+	return c.Blocks[len(c.Blocks)-1]
+}
+
+// SetData rehashes the next blocks too so every block still links to its parent
+func (c *BlockChainState) SetData(index int, data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || index >= len(c.Blocks) {
+		return fmt.Errorf("index = %d, blocks = %d: fails the condition that: 0 <= index < blocks", index, len(c.Blocks))
+	}
+	// the hash of a block covers the data of the blocks before it
+	for i := index; i < len(c.Blocks); i++ {
+		if c.decided[c.Blocks[i].Height] {
+			return fmt.Errorf("the block at the height %d is decided, it cannot be rehashed", c.Blocks[i].Height)
+		}
+	}
+	c.Blocks[index].Data = data
+	for i := index; i < len(c.Blocks); i++ {
+		block := c.Blocks[i]
+		if i > 0 {
+			block.ParentHash = c.Blocks[i-1].BlockHash
+		}
+		block.BlockHash = block.Hash()
+	}
+	err := c.storage.PutBatch(c.Blocks[index:])
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to store the blocks from the height %d", c.Blocks[index].Height))
+	}
+	return nil
+}
+
+func (c *BlockChainState) Decide(index int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if index < 0 || index >= len(c.Blocks) {
+		return fmt.Errorf("index = %d, blocks = %d: fails the condition that: 0 <= index < blocks", index, len(c.Blocks))
+	}
+	height := c.Blocks[index].Height
+	err := c.storage.Decide(height)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to store the decision of the block at the height %d", height))
+	}
+	c.decided[height] = true
+	return nil
+}
+
+func (c *BlockChainState) Decided(index int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return index >= 0 && index < len(c.Blocks) && c.decided[c.Blocks[index].Height]
+}
+
+// LastDecided is nil when the first block is not decided
+func (c *BlockChainState) LastDecided() *Block {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var last *Block
+	for _, block := range c.Blocks {
+		if !c.decided[block.Height] {
+			break
+		}
+		last = block
+	}
+	return last
+}
+
+func (c *BlockChainState) Close() error {
+	return c.storage.Close()
+}
+
+func (c *BlockChainState) Verify() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var parent *Block
+	for _, block := range c.Blocks {
+		err := block.Verify(parent)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("invalid block at the height %d", block.Height))
+		}
+		parent = block
+	}
+	return nil
+}
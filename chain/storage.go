@@ -0,0 +1,195 @@
+package chain
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Storage interface {
+	// Put replaces the block stored at the same height
+	Put(block *Block) error
+	// PutBatch stores either every block or none
+	PutBatch(blocks []*Block) error
+	Blocks() ([]*Block, error)
+	Decide(height uint64) error
+	Decided() ([]uint64, error)
+	Close() error
+}
+
+type MemoryStorage struct {
+	mu      sync.Mutex
+	blocks  map[uint64]*Block
+	decided map[uint64]bool
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		blocks:  make(map[uint64]*Block),
+		decided: make(map[uint64]bool),
+	}
+}
+
+func (s *MemoryStorage) Put(block *Block) error {
+	return s.PutBatch([]*Block{block})
+}
+
+func (s *MemoryStorage) PutBatch(blocks []*Block) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, block := range blocks {
+		s.blocks[block.Height] = block
+	}
+	return nil
+}
+
+func (s *MemoryStorage) Blocks() ([]*Block, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blocks := make([]*Block, 0, len(s.blocks))
+	for _, block := range s.blocks {
+		blocks = append(blocks, block)
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Height < blocks[j].Height
+	})
+	return blocks, nil
+}
+
+func (s *MemoryStorage) Decide(height uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.decided[height] = true
+	return nil
+}
+
+func (s *MemoryStorage) Decided() ([]uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	heights := make([]uint64, 0, len(s.decided))
+	for height := range s.decided {
+		heights = append(heights, height)
+	}
+	sort.Slice(heights, func(i, j int) bool {
+		return heights[i] < heights[j]
+	})
+	return heights, nil
+}
+
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+var (
+	blocksBucket = []byte("blocks")
+	// decidedBucket has a key for the height of every decided block
+	decidedBucket = []byte("decided")
+)
+
+// BoltStorage keys a block by its height in big endian so the blocks are read in order
+type BoltStorage struct {
+	db *bolt.DB
+}
+
+func NewBoltStorage(path string) (*BoltStorage, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to open the storage %s", path))
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{blocksBucket, decidedBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "unable to create the buckets of the storage")
+	}
+	return &BoltStorage{
+		db: db,
+	}, nil
+}
+
+func (s *BoltStorage) Put(block *Block) error {
+	return s.PutBatch([]*Block{block})
+}
+
+// PutBatch writes the blocks in a single transaction, so a rehashed chain costs one write to the disk
+func (s *BoltStorage) PutBatch(blocks []*Block) error {
+	values := make([][]byte, len(blocks))
+	for i, block := range blocks {
+		value, err := json.Marshal(block)
+		if err != nil {
+			return err
+		}
+		values[i] = value
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(blocksBucket)
+		for i, block := range blocks {
+			err := bucket.Put(heightKey(block.Height), values[i])
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *BoltStorage) Blocks() ([]*Block, error) {
+	blocks := make([]*Block, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(blocksBucket).ForEach(func(k, v []byte) error {
+			var block Block
+			err := json.Unmarshal(v, &block)
+			if err != nil {
+				return errors.Wrap(err, fmt.Sprintf("unable to decode the block at the height %d", binary.BigEndian.Uint64(k)))
+			}
+			blocks = append(blocks, &block)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (s *BoltStorage) Decide(height uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(decidedBucket).Put(heightKey(height), []byte{1})
+	})
+}
+
+func (s *BoltStorage) Decided() ([]uint64, error) {
+	heights := make([]uint64, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(decidedBucket).ForEach(func(k, v []byte) error {
+			heights = append(heights, binary.BigEndian.Uint64(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return heights, nil
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+func heightKey(height uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, height)
+	return key
+}
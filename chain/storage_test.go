@@ -0,0 +1,56 @@
+package chain
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBoltStorageReloadsTheDecidedChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.db")
+	storage, err := NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := LoadBlockChainState(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if err := c.Add(NewBlock(c.LastBlock(), []byte{'a', byte(i)}, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the data of the second block changes, the blocks after it are rehashed and stored in one batch
+	if err := c.SetData(1, []byte{'b', 1}); err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{0, 1} {
+		if err := c.Decide(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage, err = NewBoltStorage(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloaded, err := LoadBlockChainState(storage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reloaded.Close()
+	if len(reloaded.Blocks) != len(c.Blocks) {
+		t.Fatalf("%d blocks were reloaded, want %d", len(reloaded.Blocks), len(c.Blocks))
+	}
+	for i, block := range reloaded.Blocks {
+		if block.BlockHash != c.Blocks[i].BlockHash {
+			t.Errorf("block %d has the hash %s, want %s", i, block.BlockHash, c.Blocks[i].BlockHash)
+		}
+		if reloaded.Decided(i) != (i <= 1) {
+			t.Errorf("block %d: decided = %v, want %v", i, reloaded.Decided(i), i <= 1)
+		}
+	}
+}
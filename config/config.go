@@ -0,0 +1,346 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/byzantine"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/tracing"
+	"github.com/tiennampham23/avalanche-consensus-simulator/simulator"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	SnowballEngine  = "snowball"
+	AvalancheEngine = "avalanche"
+	SnowmanEngine   = "snowman"
+)
+
+type Config struct {
+	ProtocolID  string `json:"protocol_id" yaml:"protocol_id" toml:"protocol_id"`
+	ServiceName string `json:"service_name" yaml:"service_name" toml:"service_name"`
+	Host        string `json:"host" yaml:"host" toml:"host"`
+	// the next nodes use the next ports, free ports are used when Port is 0
+	Port             int    `json:"port" yaml:"port" toml:"port"`
+	DiscoveryAddress string `json:"discovery_address" yaml:"discovery_address" toml:"discovery_address"`
+	// the nodes trust the first discovery that answers when DiscoveryNodeID is empty
+	DiscoveryNodeID string `json:"discovery_node_id" yaml:"discovery_node_id" toml:"discovery_node_id"`
+	// the partition and heal routes of the discovery are disabled when DiscoveryAdminToken is empty
+	DiscoveryAdminToken string `json:"discovery_admin_token" yaml:"discovery_admin_token" toml:"discovery_admin_token"`
+	// InMemory only applies to the run command
+	InMemory bool `json:"in_memory" yaml:"in_memory" toml:"in_memory"`
+	// TLS connects the nodes and the discovery over mutual TLS, only TLS authenticates the sender of a request
+	TLS  bool  `json:"tls" yaml:"tls" toml:"tls"`
+	Seed int64 `json:"seed" yaml:"seed" toml:"seed"`
+	// Engine is SnowballEngine, AvalancheEngine or SnowmanEngine
+	Engine              string `json:"engine" yaml:"engine" toml:"engine"`
+	NumOfNodes          int    `json:"num_of_nodes" yaml:"num_of_nodes" toml:"num_of_nodes"`
+	NumOfBlocks         int    `json:"num_of_blocks" yaml:"num_of_blocks" toml:"num_of_blocks"`
+	PossiblePreferences int    `json:"possible_preferences" yaml:"possible_preferences" toml:"possible_preferences"`
+	Concurrency         int    `json:"concurrency" yaml:"concurrency" toml:"concurrency"`
+	// NumOfUTXOs is the number of inputs the avalanche transactions spend
+	NumOfUTXOs int `json:"num_of_utxos" yaml:"num_of_utxos" toml:"num_of_utxos"`
+	// NumOfProposers only applies to the snowman engine
+	NumOfProposers int                  `json:"num_of_proposers" yaml:"num_of_proposers" toml:"num_of_proposers"`
+	Consensus      consensus.Parameters `json:"consensus" yaml:"consensus" toml:"consensus"`
+	Simulation     Simulation           `json:"simulation" yaml:"simulation" toml:"simulation"`
+	// Byzantine makes the first nodes misbehave
+	Byzantine byzantine.Config `json:"byzantine" yaml:"byzantine" toml:"byzantine"`
+	Network   Network          `json:"network" yaml:"network" toml:"network"`
+	Scenario  Scenario         `json:"scenario" yaml:"scenario" toml:"scenario"`
+	// the nodes are sampled uniformly when Stake is empty
+	Stake   Stake   `json:"stake" yaml:"stake" toml:"stake"`
+	Storage Storage `json:"storage" yaml:"storage" toml:"storage"`
+	// Tracing exports the spans of the polls and of the requests between the nodes
+	Tracing tracing.Config `json:"tracing" yaml:"tracing" toml:"tracing"`
+	Sweep   Sweep          `json:"sweep" yaml:"sweep" toml:"sweep"`
+	// the report is only logged when Report is empty
+	Report string `json:"report" yaml:"report" toml:"report"`
+}
+
+type Simulation struct {
+	MinLatency Duration `json:"min_latency" yaml:"min_latency" toml:"min_latency"`
+	MaxLatency Duration `json:"max_latency" yaml:"max_latency" toml:"max_latency"`
+	MaxTime    Duration `json:"max_time" yaml:"max_time" toml:"max_time"`
+	Timeout    Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	// the values are random when Split is 0
+	Split float64 `json:"split" yaml:"split" toml:"split"`
+}
+
+func Default() *Config {
+	return &Config{
+		ProtocolID:          "avalanche-consensus-simulator/1.0.0",
+		ServiceName:         "avalanche-consensus",
+		Host:                "127.0.0.1",
+		DiscoveryAddress:    fmt.Sprintf("%s:%d", p2p.DiscoveryHost, p2p.DiscoveryPort),
+		Engine:              SnowballEngine,
+		NumOfNodes:          200,
+		NumOfBlocks:         500,
+		PossiblePreferences: 2,
+		Concurrency:         16,
+		NumOfUTXOs:          10,
+		NumOfProposers:      2,
+		Consensus: consensus.Parameters{
+			Algorithm:           consensus.SnowballAlgorithm,
+			K:                   3,
+			Alpha:               2,
+			BetaVirtuous:        2,
+			BetaRogue:           4,
+			ConcurrentRepolls:   1,
+			MaxOutstandingItems: 64,
+		},
+		Simulation: Simulation{
+			MinLatency: Duration(10 * time.Millisecond),
+			MaxLatency: Duration(100 * time.Millisecond),
+		},
+		Byzantine: byzantine.Config{
+			Strategy:           byzantine.Honest,
+			SilenceProbability: 1,
+		},
+		Scenario: Scenario{
+			Churn: Churn{
+				Downtime: Duration(time.Second),
+			},
+		},
+		Storage: Storage{
+			Backend: MemoryStorage,
+		},
+		Tracing: tracing.Config{
+			SampleRatio: 1,
+		},
+		Sweep: Sweep{
+			Repeats: 10,
+		},
+	}
+}
+
+// Load chooses the format by the extension: .yaml, .yml, .json or .toml
+func (c *Config) Load(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "unable to read the config file")
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.UnmarshalStrict(content, c)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	case ".toml":
+		err = toml.NewDecoder(bytes.NewReader(content)).DisallowUnknownFields().Decode(c)
+	default:
+		return fmt.Errorf("the format of the config file %s is unknown", path)
+	}
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to decode the config file %s", path))
+	}
+	return nil
+}
+
+func (c *Config) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ProtocolID, "protocol-id", c.ProtocolID, "protocol ID of the nodes")
+	fs.StringVar(&c.ServiceName, "service-name", c.ServiceName, "service name of the nodes")
+	fs.StringVar(&c.Host, "host", c.Host, "host the nodes listen on")
+	fs.IntVar(&c.Port, "port", c.Port, "port of the first node, free ports are used when it is 0")
+	fs.StringVar(&c.DiscoveryAddress, "discovery-address", c.DiscoveryAddress, "address of the discovery")
+	fs.StringVar(&c.DiscoveryNodeID, "discovery-node-id", c.DiscoveryNodeID, "NodeID of the discovery the nodes pin, the discovery logs it")
+	fs.StringVar(&c.DiscoveryAdminToken, "discovery-admin-token", c.DiscoveryAdminToken, "token of the partition and heal routes of the discovery, they are disabled when it is empty")
+	fs.BoolVar(&c.InMemory, "in-memory", c.InMemory, "connect the nodes with in-process channels instead of HTTP")
+	fs.BoolVar(&c.TLS, "tls", c.TLS, "connect the nodes and the discovery over mutual TLS with self-signed node certificates")
+	fs.Int64Var(&c.Seed, "seed", c.Seed, "seed of every random decision, the current time is used when it is 0")
+	fs.StringVar(&c.Report, "report", c.Report, "file the JSON report of the run is written to")
+	fs.StringVar(&c.Engine, "engine", c.Engine, "consensus engine: snowball, avalanche or snowman")
+	fs.IntVar(&c.NumOfNodes, "nodes", c.NumOfNodes, "number of nodes")
+	fs.IntVar(&c.NumOfBlocks, "blocks", c.NumOfBlocks, "number of blocks of every node")
+	fs.IntVar(&c.PossiblePreferences, "preferences", c.PossiblePreferences, "number of possible preferences of a block")
+	fs.IntVar(&c.Concurrency, "concurrency", c.Concurrency, "number of blocks every node decides at the same time")
+	fs.IntVar(&c.NumOfUTXOs, "utxos", c.NumOfUTXOs, "number of inputs the transactions of the avalanche engine spend")
+	fs.IntVar(&c.NumOfProposers, "proposers", c.NumOfProposers, "number of nodes proposing a block at every height with the snowman engine")
+	fs.StringVar((*string)(&c.Consensus.Algorithm), "algorithm", string(c.Consensus.Algorithm), "consensus algorithm: slush, snowflake, snowball, snowman or snowball-tree")
+	fs.IntVar(&c.Consensus.K, "k", c.Consensus.K, "sample size")
+	fs.IntVar(&c.Consensus.Alpha, "alpha", c.Consensus.Alpha, "quorum size")
+	fs.IntVar(&c.Consensus.BetaVirtuous, "beta-virtuous", c.Consensus.BetaVirtuous, "decision threshold without conflicts")
+	fs.IntVar(&c.Consensus.BetaRogue, "beta-rogue", c.Consensus.BetaRogue, "decision threshold with conflicts")
+	fs.IntVar(&c.Consensus.ConcurrentRepolls, "concurrent-repolls", c.Consensus.ConcurrentRepolls, "number of outstanding polls of a decision")
+	fs.IntVar(&c.Consensus.MaxOutstandingItems, "max-outstanding-items", c.Consensus.MaxOutstandingItems, "maximum number of processing decisions")
+	fs.IntVar(&c.Consensus.Rounds, "rounds", c.Consensus.Rounds, "number of rounds of slush")
+	fs.BoolVar(&c.Consensus.StakeAlpha, "stake-alpha", c.Consensus.StakeAlpha, "weigh the votes of a poll by the stake of the voters")
+	fs.Var(&c.Stake.Weights, "stake", "comma separated stakes of the first nodes, the other nodes have the stake 1")
+	fs.StringVar(&c.Stake.KeyDir, "key-dir", c.Stake.KeyDir, "directory of the keys of the nodes, a node keeps its NodeID across starts")
+	fs.Var(&c.Simulation.MinLatency, "min-latency", "minimum one way delay of a simulated message")
+	fs.Var(&c.Simulation.MaxLatency, "max-latency", "maximum one way delay of a simulated message")
+	fs.Var(&c.Simulation.MaxTime, "max-time", "virtual time the simulation stops at, 0 means no limit")
+	fs.Var(&c.Simulation.Timeout, "timeout", "how long a simulated node waits for a lost answer, twice max-latency when it is 0")
+	fs.Float64Var(&c.Simulation.Split, "split", c.Simulation.Split, "fraction of the simulated nodes starting with the first value of every block, the values are random when it is 0")
+	fs.StringVar((*string)(&c.Byzantine.Strategy), "byzantine-strategy", string(c.Byzantine.Strategy), "strategy of the byzantine nodes: honest, always-lie, random, equivocate, silent or balancing")
+	fs.Float64Var(&c.Byzantine.Fraction, "byzantine-fraction", c.Byzantine.Fraction, "fraction of the nodes that are byzantine")
+	fs.Var(&c.Network.Default.Latency, "latency", "mean one way delay added to every message")
+	fs.Var(&c.Network.Default.Jitter, "jitter", "maximum deviation of the delay added to every message")
+	fs.Float64Var(&c.Network.Default.DropProbability, "drop-probability", c.Network.Default.DropProbability, "probability a message is lost")
+	fs.IntVar(&c.Network.Default.Bandwidth, "bandwidth", c.Network.Default.Bandwidth, "bytes per second of every link, 0 means unlimited")
+	fs.Float64Var(&c.Byzantine.SilenceProbability, "silence-probability", c.Byzantine.SilenceProbability, "probability a silent node does not answer a request")
+	fs.Float64Var(&c.Scenario.Churn.Rate, "churn-rate", c.Scenario.Churn.Rate, "number of random crashes of every node per second while it decides the blocks")
+	fs.Var(&c.Scenario.Churn.Downtime, "downtime", "how long a node crashed at random stays down before it restarts")
+	fs.IntVar(&c.Scenario.Churn.LateJoiners, "late-joiners", c.Scenario.Churn.LateJoiners, "number of last nodes joining late")
+	fs.Var(&c.Scenario.Churn.JoinAt, "join-at", "how long after the other nodes the late joiners start")
+	fs.StringVar(&c.Storage.Backend, "storage", c.Storage.Backend, "storage of the blocks of the nodes: memory or bolt")
+	fs.StringVar(&c.Storage.Dir, "data-dir", c.Storage.Dir, "directory of the files of the bolt storage, a restarted node reloads its chain from it")
+	fs.StringVar(&c.Tracing.Exporter, "tracing-exporter", c.Tracing.Exporter, "exporter of the traces: file, memory or empty to disable the tracing")
+	fs.StringVar(&c.Tracing.File, "tracing-file", c.Tracing.File, "file the file exporter writes the spans to")
+	fs.Float64Var(&c.Tracing.SampleRatio, "tracing-sample-ratio", c.Tracing.SampleRatio, "fraction of the traces recorded")
+	fs.Var(&c.Sweep.K, "sweep-k", "values of k explored by the sweep, as min:max:step")
+	fs.Var(&c.Sweep.Alpha, "sweep-alpha", "values of alpha explored by the sweep, as min:max:step")
+	fs.Var(&c.Sweep.Beta, "sweep-beta", "values of beta-virtuous explored by the sweep, as min:max:step, beta-rogue keeps its distance to it")
+	fs.Var(&c.Sweep.NumOfNodes, "sweep-nodes", "numbers of nodes explored by the sweep, as min:max:step")
+	fs.Var(&c.Sweep.ByzantineFraction, "sweep-byzantine-fraction", "byzantine fractions explored by the sweep, as min:max:step")
+	fs.Var(&c.Sweep.Split, "sweep-split", "initial splits explored by the sweep, as min:max:step")
+	fs.Var(&c.Sweep.ChurnRate, "sweep-churn-rate", "churn rates explored by the sweep, as min:max:step")
+	fs.IntVar(&c.Sweep.Repeats, "repeats", c.Sweep.Repeats, "number of seeded simulations of every cell of the sweep")
+	fs.StringVar(&c.Sweep.Output, "output", c.Sweep.Output, "CSV file the results of the sweep are written to, the standard output is used when it is empty")
+}
+
+// Parse loads the file of the -config flag first, the other flags override it
+func Parse(command string, args []string) (*Config, error) {
+	c := Default()
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	path := fs.String("config", "", "path of a YAML, JSON or TOML config file")
+	c.Flags(fs)
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if *path != "" {
+		err = c.Load(*path)
+		if err != nil {
+			return nil, err
+		}
+		// the flags are parsed again so they take precedence over the file
+		err = fs.Parse(args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	err = c.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the config")
+	}
+	return c, nil
+}
+
+func (c *Config) Verify() error {
+	switch {
+	case c.Engine != SnowballEngine && c.Engine != AvalancheEngine && c.Engine != SnowmanEngine:
+		return fmt.Errorf("engine = %s: fails the condition that: engine is %s, %s or %s", c.Engine, SnowballEngine, AvalancheEngine, SnowmanEngine)
+	case c.NumOfNodes < c.Consensus.K:
+		return fmt.Errorf("numOfNodes = %d, k = %d: fails the condition that: k <= numOfNodes", c.NumOfNodes, c.Consensus.K)
+	case c.NumOfBlocks <= 0:
+		return fmt.Errorf("numOfBlocks = %d: fails the condition that: 0 < numOfBlocks", c.NumOfBlocks)
+	case c.PossiblePreferences <= 0 || c.PossiblePreferences > 128:
+		return fmt.Errorf("possiblePreferences = %d: fails the condition that: 0 < possiblePreferences <= 128", c.PossiblePreferences)
+	case c.Concurrency < 0:
+		return fmt.Errorf("concurrency = %d: fails the condition that: 0 <= concurrency", c.Concurrency)
+	case c.Engine == AvalancheEngine && c.NumOfUTXOs <= 0:
+		return fmt.Errorf("numOfUTXOs = %d: fails the condition that: 0 < numOfUTXOs", c.NumOfUTXOs)
+	case c.Engine == SnowmanEngine && (c.NumOfProposers <= 0 || c.NumOfProposers > c.NumOfNodes):
+		return fmt.Errorf("numOfProposers = %d, numOfNodes = %d: fails the condition that: 0 < numOfProposers <= numOfNodes", c.NumOfProposers, c.NumOfNodes)
+	case c.Port < 0 || c.Port+c.NumOfNodes > 65536:
+		return fmt.Errorf("port = %d, numOfNodes = %d: fails the condition that: 0 <= port and port+numOfNodes <= 65536", c.Port, c.NumOfNodes)
+	case c.Simulation.MinLatency < 0 || c.Simulation.MaxLatency < c.Simulation.MinLatency:
+		return fmt.Errorf("minLatency = %s, maxLatency = %s: fails the condition that: 0 <= minLatency <= maxLatency", c.Simulation.MinLatency, c.Simulation.MaxLatency)
+	case c.Simulation.Split < 0 || c.Simulation.Split > 1:
+		return fmt.Errorf("split = %v: fails the condition that: 0 <= split <= 1", c.Simulation.Split)
+	case c.TLS && c.InMemory:
+		return fmt.Errorf("tls only applies to the nodes connected over HTTP, the in-memory network has no TLS")
+	case c.Engine == AvalancheEngine && !c.Scenario.Churn.IsZero():
+		return fmt.Errorf("the churn only applies to the %s and %s engines", SnowballEngine, SnowmanEngine)
+	}
+	err := c.Byzantine.Verify()
+	if err != nil {
+		return err
+	}
+	err = c.Network.Verify(c.NumOfNodes)
+	if err != nil {
+		return err
+	}
+	err = c.Scenario.Verify(c.NumOfNodes)
+	if err != nil {
+		return err
+	}
+	err = c.Stake.Verify(c.NumOfNodes, c.Consensus.K)
+	if err != nil {
+		return err
+	}
+	err = c.Storage.Verify()
+	if err != nil {
+		return err
+	}
+	err = c.Tracing.Verify()
+	if err != nil {
+		return err
+	}
+	err = c.Sweep.Verify()
+	if err != nil {
+		return err
+	}
+	return c.Consensus.Verify()
+}
+
+func (c *Config) P2PConfig(j int) p2p.Config {
+	cfg := p2p.Config{
+		Name:             c.ServiceName,
+		ProtocolID:       c.ProtocolID,
+		Host:             c.Host,
+		DiscoveryAddress: c.DiscoveryAddress,
+		DiscoveryNodeID:  c.DiscoveryNodeID,
+		TLS:              c.TLS,
+	}
+	if c.Port > 0 {
+		cfg.Port = c.Port + j
+	}
+	return cfg
+}
+
+func (c *Config) NodeSeed(j int) int64 {
+	if c.Seed == 0 {
+		return 0
+	}
+	return c.Seed + int64(j)
+}
+
+func (c *Config) SimulatorConfig(seed int64) simulator.Config {
+	var links func(from, to int) p2p.LinkConditions
+	if !c.Network.IsZero() {
+		links = c.Network.Link
+	}
+	return simulator.Config{
+		Seed:                seed,
+		NumOfNodes:          c.NumOfNodes,
+		NumOfBlocks:         c.NumOfBlocks,
+		PossiblePreferences: c.PossiblePreferences,
+		Split:               c.Simulation.Split,
+		Parameters:          c.Consensus,
+		Concurrency:         c.Concurrency,
+		MinLatency:          time.Duration(c.Simulation.MinLatency),
+		MaxLatency:          time.Duration(c.Simulation.MaxLatency),
+		MaxTime:             time.Duration(c.Simulation.MaxTime),
+		Timeout:             time.Duration(c.Simulation.Timeout),
+		Links:               links,
+		Byzantine:           c.Byzantine,
+		Partitions:          c.Scenario.SimulatorPartitions(),
+		Churn:               c.Scenario.SimulatorChurn(),
+		Weights:             c.Stake.NodeWeights(c.NumOfNodes),
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigLoadRejectsUnknownFields(t *testing.T) {
+	tests := []struct {
+		file    string
+		content string
+		valid   bool
+	}{
+		{file: "config.yaml", content: "num_of_nodes: 20\n", valid: true},
+		{file: "config.yaml", content: "num_of_node: 20\n"},
+		{file: "config.json", content: `{"num_of_nodes": 20}`, valid: true},
+		{file: "config.json", content: `{"num_of_node": 20}`},
+		{file: "config.toml", content: "num_of_nodes = 20\n", valid: true},
+		{file: "config.toml", content: "num_of_node = 20\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.content, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			c := Default()
+			err := c.Load(path)
+			if (err == nil) != tt.valid {
+				t.Fatalf("Load() = %v, want valid = %v", err, tt.valid)
+			}
+			if tt.valid && c.NumOfNodes != 20 {
+				t.Errorf("numOfNodes = %d, want 20", c.NumOfNodes)
+			}
+		})
+	}
+}
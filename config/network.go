@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"time"
+)
+
+type Link struct {
+	Latency         Duration `json:"latency" yaml:"latency" toml:"latency"`
+	Jitter          Duration `json:"jitter" yaml:"jitter" toml:"jitter"`
+	DropProbability float64  `json:"drop_probability" yaml:"drop_probability" toml:"drop_probability"`
+	Bandwidth       int      `json:"bandwidth" yaml:"bandwidth" toml:"bandwidth"`
+}
+
+func (l Link) conditions() p2p.LinkConditions {
+	return p2p.LinkConditions{
+		Latency:         time.Duration(l.Latency),
+		Jitter:          time.Duration(l.Jitter),
+		DropProbability: l.DropProbability,
+		Bandwidth:       l.Bandwidth,
+	}
+}
+
+// the first Region starts at the first node
+type Region struct {
+	Name       string `json:"name" yaml:"name" toml:"name"`
+	NumOfNodes int    `json:"num_of_nodes" yaml:"num_of_nodes" toml:"num_of_nodes"`
+}
+
+type RegionLink struct {
+	From string `json:"from" yaml:"from" toml:"from"`
+	To   string `json:"to" yaml:"to" toml:"to"`
+	Link Link   `json:"link" yaml:"link" toml:"link"`
+}
+
+type NodeLink struct {
+	Node int  `json:"node" yaml:"node" toml:"node"`
+	Link Link `json:"link" yaml:"link" toml:"link"`
+}
+
+// Network prefers the conditions of a node to the ones of its region, and those to the default
+type Network struct {
+	Default Link         `json:"default" yaml:"default" toml:"default"`
+	Regions []Region     `json:"regions" yaml:"regions" toml:"regions"`
+	Links   []RegionLink `json:"links" yaml:"links" toml:"links"`
+	Nodes   []NodeLink   `json:"nodes" yaml:"nodes" toml:"nodes"`
+}
+
+func (n *Network) Verify(numOfNodes int) error {
+	links := []Link{n.Default}
+	regions := make(map[string]bool, len(n.Regions))
+	inRegions := 0
+	for _, region := range n.Regions {
+		if region.Name == "" || regions[region.Name] {
+			return fmt.Errorf("the name of the region %q is empty or duplicated", region.Name)
+		}
+		if region.NumOfNodes <= 0 {
+			return fmt.Errorf("numOfNodes = %d: fails the condition that: 0 < numOfNodes of the region %s", region.NumOfNodes, region.Name)
+		}
+		regions[region.Name] = true
+		inRegions += region.NumOfNodes
+	}
+	if inRegions > numOfNodes {
+		return fmt.Errorf("numOfNodes = %d, nodes in regions = %d: fails the condition that: nodes in regions <= numOfNodes", numOfNodes, inRegions)
+	}
+	for _, link := range n.Links {
+		if !regions[link.From] || !regions[link.To] {
+			return fmt.Errorf("the link from %s to %s refers to an unknown region", link.From, link.To)
+		}
+		links = append(links, link.Link)
+	}
+	for _, node := range n.Nodes {
+		if node.Node < 0 || node.Node >= numOfNodes {
+			return fmt.Errorf("node = %d, numOfNodes = %d: fails the condition that: 0 <= node < numOfNodes", node.Node, numOfNodes)
+		}
+		links = append(links, node.Link)
+	}
+	for _, link := range links {
+		conditions := link.conditions()
+		err := conditions.Verify()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Region is empty if the j-th node is in no region
+func (n *Network) Region(j int) string {
+	for _, region := range n.Regions {
+		if j < region.NumOfNodes {
+			return region.Name
+		}
+		j -= region.NumOfNodes
+	}
+	return ""
+}
+
+func (n *Network) Link(i, j int) p2p.LinkConditions {
+	for _, node := range n.Nodes {
+		if node.Node == i || node.Node == j {
+			return node.Link.conditions()
+		}
+	}
+	from, to := n.Region(i), n.Region(j)
+	for _, link := range n.Links {
+		if (link.From == from && link.To == to) || (link.From == to && link.To == from) {
+			return link.Link.conditions()
+		}
+	}
+	return n.Default.conditions()
+}
+
+// Conditions applies the default to an unknown address, the requests to the discovery are not degraded
+func (n *Network) Conditions(discoveryAddress string, nodeIndex func(address string) (int, bool)) p2p.Conditions {
+	return func(from, to string) p2p.LinkConditions {
+		if from == discoveryAddress || to == discoveryAddress {
+			return p2p.LinkConditions{}
+		}
+		i, ok := nodeIndex(from)
+		if !ok {
+			return n.Default.conditions()
+		}
+		j, ok := nodeIndex(to)
+		if !ok {
+			return n.Default.conditions()
+		}
+		return n.Link(i, j)
+	}
+}
+
+func (n *Network) IsZero() bool {
+	return n.Default == Link{} && len(n.Regions) == 0 && len(n.Links) == 0 && len(n.Nodes) == 0
+}
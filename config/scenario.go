@@ -0,0 +1,79 @@
+package config
+
+import (
+	"github.com/tiennampham23/avalanche-consensus-simulator/simulator"
+	"time"
+)
+
+type Partition struct {
+	// Start and End are since the start of the nodes
+	Start Duration `json:"start" yaml:"start" toml:"start"`
+	End   Duration `json:"end" yaml:"end" toml:"end"`
+	// the nodes in no group form one more group
+	Groups []int `json:"groups" yaml:"groups" toml:"groups"`
+}
+
+// Crash restarts a node from its storage at End, it never restarts when End is 0
+type Crash struct {
+	Node  int      `json:"node" yaml:"node" toml:"node"`
+	Start Duration `json:"start" yaml:"start" toml:"start"`
+	End   Duration `json:"end" yaml:"end" toml:"end"`
+}
+
+type Churn struct {
+	Crashes []Crash `json:"crashes" yaml:"crashes" toml:"crashes"`
+	// Rate is the number of random crashes of every node per second
+	Rate     float64  `json:"rate" yaml:"rate" toml:"rate"`
+	Downtime Duration `json:"downtime" yaml:"downtime" toml:"downtime"`
+	// LateJoiners are the last nodes
+	LateJoiners int      `json:"late_joiners" yaml:"late_joiners" toml:"late_joiners"`
+	JoinAt      Duration `json:"join_at" yaml:"join_at" toml:"join_at"`
+}
+
+type Scenario struct {
+	Partitions []Partition `json:"partitions" yaml:"partitions" toml:"partitions"`
+	Churn      Churn       `json:"churn" yaml:"churn" toml:"churn"`
+}
+
+func (s *Scenario) SimulatorPartitions() []simulator.Partition {
+	partitions := make([]simulator.Partition, 0, len(s.Partitions))
+	for _, p := range s.Partitions {
+		partitions = append(partitions, simulator.Partition{
+			Start:  time.Duration(p.Start),
+			End:    time.Duration(p.End),
+			Groups: p.Groups,
+		})
+	}
+	return partitions
+}
+
+func (s *Scenario) SimulatorChurn() simulator.Churn {
+	churn := simulator.Churn{
+		Crashes:     make([]simulator.Crash, 0, len(s.Churn.Crashes)),
+		Rate:        s.Churn.Rate,
+		Downtime:    time.Duration(s.Churn.Downtime),
+		LateJoiners: s.Churn.LateJoiners,
+		JoinAt:      time.Duration(s.Churn.JoinAt),
+	}
+	for _, c := range s.Churn.Crashes {
+		churn.Crashes = append(churn.Crashes, simulator.Crash{
+			Node:  c.Node,
+			Start: time.Duration(c.Start),
+			End:   time.Duration(c.End),
+		})
+	}
+	return churn
+}
+
+func (s *Scenario) Verify(numOfNodes int) error {
+	err := simulator.VerifyPartitions(s.SimulatorPartitions(), numOfNodes)
+	if err != nil {
+		return err
+	}
+	churn := s.SimulatorChurn()
+	return churn.Verify(numOfNodes)
+}
+
+func (c *Churn) IsZero() bool {
+	return len(c.Crashes) == 0 && c.Rate == 0 && c.LateJoiners == 0
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Weights are written as "100,1,1" in the flags
+type Weights []uint64
+
+func (w Weights) String() string {
+	values := make([]string, len(w))
+	for i, weight := range w {
+		values[i] = strconv.FormatUint(weight, 10)
+	}
+	return strings.Join(values, ",")
+}
+
+func (w *Weights) Set(value string) error {
+	*w = nil
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		weight, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return fmt.Errorf("the weights %q are not made of non-negative integers", value)
+		}
+		*w = append(*w, weight)
+	}
+	return nil
+}
+
+type Stake struct {
+	Weights Weights `json:"weights" yaml:"weights" toml:"weights"`
+	// Validators replace the weights in the node and discovery commands, which do not know the NodeIDs of every node
+	Validators map[string]uint64 `json:"validators" yaml:"validators" toml:"validators"`
+	// KeyDir keeps the NodeIDs the same at every start, a new key is generated at every start when it is empty
+	KeyDir string `json:"key_dir" yaml:"key_dir" toml:"key_dir"`
+}
+
+func (s *Stake) IsZero() bool {
+	return len(s.Weights) == 0 && len(s.Validators) == 0
+}
+
+func (s *Stake) Weight(j int) uint64 {
+	if j < len(s.Weights) {
+		return s.Weights[j]
+	}
+	return 1
+}
+
+// NodeWeights is nil when every node has the same stake
+func (s *Stake) NodeWeights(numOfNodes int) []uint64 {
+	if s.IsZero() {
+		return nil
+	}
+	weights := make([]uint64, numOfNodes)
+	for j := range weights {
+		weights[j] = s.Weight(j)
+	}
+	return weights
+}
+
+// Share returns the fraction of the stake held by the first n nodes
+func (s *Stake) Share(n, numOfNodes int) float64 {
+	var held, total float64
+	for j := 0; j < numOfNodes; j++ {
+		if j < n {
+			held += float64(s.Weight(j))
+		}
+		total += float64(s.Weight(j))
+	}
+	if total == 0 {
+		return 0
+	}
+	return held / total
+}
+
+func (s *Stake) Verify(numOfNodes, k int) error {
+	if len(s.Validators) > 0 {
+		return s.verifyValidators(k)
+	}
+	if len(s.Weights) > numOfNodes {
+		return fmt.Errorf("weights = %d, numOfNodes = %d: fails the condition that: weights <= numOfNodes", len(s.Weights), numOfNodes)
+	}
+	validators := 0
+	var total uint64
+	for j := 0; j < numOfNodes; j++ {
+		weight := s.Weight(j)
+		if weight > math.MaxUint64-total {
+			return fmt.Errorf("the total stake of the nodes overflows")
+		}
+		total += weight
+		if weight > 0 {
+			validators++
+		}
+	}
+	if validators < k {
+		return fmt.Errorf("validators = %d, k = %d: fails the condition that: k <= validators", validators, k)
+	}
+	return nil
+}
+
+func (s *Stake) verifyValidators(k int) error {
+	if len(s.Weights) > 0 {
+		return fmt.Errorf("the stake is set by the weights and by the validators")
+	}
+	validators := 0
+	var total uint64
+	for _, weight := range s.Validators {
+		if weight > math.MaxUint64-total {
+			return fmt.Errorf("the total stake of the validators overflows")
+		}
+		total += weight
+		if weight > 0 {
+			validators++
+		}
+	}
+	if validators < k {
+		return fmt.Errorf("validators = %d, k = %d: fails the condition that: k <= validators", validators, k)
+	}
+	return nil
+}
+
+func (s *Stake) Identity(j int) (*p2p.Identity, error) {
+	return s.identity(fmt.Sprintf("node-%d.key", j))
+}
+
+func (s *Stake) DiscoveryIdentity() (*p2p.Identity, error) {
+	return s.identity("discovery.key")
+}
+
+func (s *Stake) identity(name string) (*p2p.Identity, error) {
+	if s.KeyDir == "" {
+		return p2p.NewIdentity()
+	}
+	err := os.MkdirAll(s.KeyDir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the directory of the keys")
+	}
+	return p2p.LoadIdentity(filepath.Join(s.KeyDir, name))
+}
+
+// NodeValidators is nil when every node has the same stake
+func (s *Stake) NodeValidators(identities []*p2p.Identity) p2p.Validators {
+	if len(s.Validators) > 0 {
+		validators := make(p2p.Validators, len(s.Validators))
+		for nodeID, weight := range s.Validators {
+			validators[nodeID] = weight
+		}
+		return validators
+	}
+	if s.IsZero() {
+		return nil
+	}
+	validators := make(p2p.Validators, len(identities))
+	for j, identity := range identities {
+		validators[identity.NodeID()] = s.Weight(j)
+	}
+	return validators
+}
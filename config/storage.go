@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"os"
+	"path/filepath"
+)
+
+const (
+	MemoryStorage = "memory"
+	// BoltStorage keeps a bbolt file per node in Dir, a restarted node reloads its chain
+	BoltStorage = "bolt"
+)
+
+type Storage struct {
+	Backend string `json:"backend" yaml:"backend" toml:"backend"`
+	Dir     string `json:"dir" yaml:"dir" toml:"dir"`
+}
+
+func (s *Storage) Verify() error {
+	switch s.Backend {
+	case MemoryStorage:
+	case BoltStorage:
+		if s.Dir == "" {
+			return fmt.Errorf("the directory of the %s storage is empty", BoltStorage)
+		}
+	default:
+		return fmt.Errorf("the storage backend %s is unknown", s.Backend)
+	}
+	return nil
+}
+
+func (s *Storage) Open(j int) (chain.Storage, error) {
+	if s.Backend != BoltStorage {
+		return chain.NewMemoryStorage(), nil
+	}
+	err := os.MkdirAll(s.Dir, 0700)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create the directory of the storage")
+	}
+	return chain.NewBoltStorage(filepath.Join(s.Dir, fmt.Sprintf("node-%d.db", j)))
+}
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"fmt"
+	"github.com/tiennampham23/avalanche-consensus-simulator/simulator"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IntRange is written as "min:max:step", "min:max" with a step of 1 or a single value, an empty range keeps the value of the config
+type IntRange struct {
+	Min, Max, Step int
+}
+
+func (r IntRange) Values(value int) []int {
+	if r.IsZero() {
+		return []int{value}
+	}
+	values := make([]int, 0)
+	for v := r.Min; v <= r.Max; v += r.Step {
+		values = append(values, v)
+	}
+	return values
+}
+
+func (r IntRange) IsZero() bool {
+	return r == IntRange{}
+}
+
+func (r IntRange) Verify() error {
+	if r.IsZero() {
+		return nil
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return fmt.Errorf("range = %s: fails the condition that: min <= max and 0 < step", r)
+	}
+	return nil
+}
+
+func (r IntRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d:%d", r.Min, r.Max, r.Step)
+}
+
+func (r *IntRange) Set(value string) error {
+	parts, err := splitRange(value)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		*r = IntRange{}
+		return nil
+	}
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		numbers[i], err = strconv.Atoi(part)
+		if err != nil {
+			return fmt.Errorf("the range %q is not made of integers", value)
+		}
+	}
+	*r = IntRange{Min: numbers[0], Max: numbers[0], Step: 1}
+	if len(numbers) > 1 {
+		r.Max = numbers[1]
+	}
+	if len(numbers) > 2 {
+		r.Step = numbers[2]
+	}
+	return r.Verify()
+}
+
+func (r IntRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *IntRange) UnmarshalText(text []byte) error {
+	return r.Set(string(text))
+}
+
+// FloatRange is written as "min:max:step" or a single value
+type FloatRange struct {
+	Min, Max, Step float64
+}
+
+func (r FloatRange) Values(value float64) []float64 {
+	if r.IsZero() {
+		return []float64{value}
+	}
+	values := make([]float64, 0)
+	// the values are computed from their position so the rounding errors do not add up
+	for i := 0; ; i++ {
+		v := r.Min + float64(i)*r.Step
+		if v > r.Max+r.Step/1e6 {
+			break
+		}
+		values = append(values, math.Round(v*1e6)/1e6)
+	}
+	return values
+}
+
+func (r FloatRange) IsZero() bool {
+	return r == FloatRange{}
+}
+
+func (r FloatRange) Verify() error {
+	if r.IsZero() {
+		return nil
+	}
+	if r.Step <= 0 || r.Max < r.Min {
+		return fmt.Errorf("range = %s: fails the condition that: min <= max and 0 < step", r)
+	}
+	return nil
+}
+
+func (r FloatRange) String() string {
+	if r.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf("%v:%v:%v", r.Min, r.Max, r.Step)
+}
+
+func (r *FloatRange) Set(value string) error {
+	parts, err := splitRange(value)
+	if err != nil {
+		return err
+	}
+	if len(parts) == 0 {
+		*r = FloatRange{}
+		return nil
+	}
+	if len(parts) == 2 {
+		return fmt.Errorf("the range %q needs a step", value)
+	}
+	numbers := make([]float64, len(parts))
+	for i, part := range parts {
+		numbers[i], err = strconv.ParseFloat(part, 64)
+		if err != nil {
+			return fmt.Errorf("the range %q is not made of numbers", value)
+		}
+	}
+	*r = FloatRange{Min: numbers[0], Max: numbers[0], Step: 1}
+	if len(numbers) > 2 {
+		r.Max, r.Step = numbers[1], numbers[2]
+	}
+	return r.Verify()
+}
+
+func (r FloatRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *FloatRange) UnmarshalText(text []byte) error {
+	return r.Set(string(text))
+}
+
+func splitRange(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("the range %q is not min:max:step", value)
+	}
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+	return parts, nil
+}
+
+// Sweep simulates every combination of the values Repeats times with the seeds Seed, Seed+1, ...
+type Sweep struct {
+	K     IntRange `json:"k" yaml:"k" toml:"k"`
+	Alpha IntRange `json:"alpha" yaml:"alpha" toml:"alpha"`
+	// Beta sets BetaVirtuous, BetaRogue keeps its distance to BetaVirtuous
+	Beta       IntRange `json:"beta" yaml:"beta" toml:"beta"`
+	NumOfNodes IntRange `json:"num_of_nodes" yaml:"num_of_nodes" toml:"num_of_nodes"`
+	// ByzantineFraction only makes nodes byzantine when the byzantine strategy is not honest
+	ByzantineFraction FloatRange `json:"byzantine_fraction" yaml:"byzantine_fraction" toml:"byzantine_fraction"`
+	Split             FloatRange `json:"split" yaml:"split" toml:"split"`
+	ChurnRate         FloatRange `json:"churn_rate" yaml:"churn_rate" toml:"churn_rate"`
+	Repeats           int        `json:"repeats" yaml:"repeats" toml:"repeats"`
+	// the results are written to the standard output when Output is empty
+	Output string `json:"output" yaml:"output" toml:"output"`
+}
+
+func (s *Sweep) Verify() error {
+	for _, r := range []IntRange{s.K, s.Alpha, s.Beta, s.NumOfNodes} {
+		err := r.Verify()
+		if err != nil {
+			return err
+		}
+	}
+	for _, r := range []FloatRange{s.ByzantineFraction, s.Split, s.ChurnRate} {
+		err := r.Verify()
+		if err != nil {
+			return err
+		}
+	}
+	if s.Repeats <= 0 {
+		return fmt.Errorf("repeats = %d: fails the condition that: 0 < repeats", s.Repeats)
+	}
+	return nil
+}
+
+// SweepCells skips and counts the combinations with invalid parameters, like alpha > k
+func (c *Config) SweepCells() ([]simulator.Cell, int) {
+	cells := make([]simulator.Cell, 0)
+	skipped := 0
+	rogue := c.Consensus.BetaRogue - c.Consensus.BetaVirtuous
+	for _, nodes := range c.Sweep.NumOfNodes.Values(c.NumOfNodes) {
+		for _, fraction := range c.Sweep.ByzantineFraction.Values(c.Byzantine.Fraction) {
+			for _, split := range c.Sweep.Split.Values(c.Simulation.Split) {
+				for _, churnRate := range c.Sweep.ChurnRate.Values(c.Scenario.Churn.Rate) {
+					for _, k := range c.Sweep.K.Values(c.Consensus.K) {
+						for _, alpha := range c.Sweep.Alpha.Values(c.Consensus.Alpha) {
+							for _, beta := range c.Sweep.Beta.Values(c.Consensus.BetaVirtuous) {
+								parameters := c.Consensus
+								parameters.K = k
+								parameters.Alpha = alpha
+								parameters.BetaVirtuous = beta
+								parameters.BetaRogue = beta + rogue
+								cell := simulator.Cell{
+									Parameters:        parameters,
+									NumOfNodes:        nodes,
+									ByzantineFraction: fraction,
+									Split:             split,
+									ChurnRate:         churnRate,
+								}
+								cfg := c.SimulatorConfig(0)
+								cfg.Parameters, cfg.NumOfNodes, cfg.Byzantine.Fraction, cfg.Split = parameters, nodes, fraction, split
+								cfg.Churn.Rate = churnRate
+								if cfg.Verify() != nil {
+									skipped++
+									continue
+								}
+								cells = append(cells, cell)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return cells, skipped
+}
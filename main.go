@@ -2,144 +2,762 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"github.com/gin-gonic/gin"
 	"github.com/phayes/freeport"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/byzantine"
 	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/config"
 	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
 	"github.com/tiennampham23/avalanche-consensus-simulator/node"
 	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
-	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/tracing"
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
+	"github.com/tiennampham23/avalanche-consensus-simulator/simulator"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/avalanche"
+	"math"
 	"math/rand"
 	"os"
 	"os/signal"
+	"runtime"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
-const (
-	protocolID          = "avalanche-consensus-simulator/1.0.0"
-	serviceName         = "avalanche-consensus"
-	host                = "127.0.0.1"
-	k                   = 3
-	alpha               = 2
-	beta                = 2
-	numOfBlocks         = 500
-	possiblePreferences = 2
-	numOfNodes          = 200
-)
+const defaultSweepMaxTime = 5 * time.Minute
+
+const usage = `Usage: avalanche-consensus-simulator <command> [flags]
+
+Commands:
+  run        run the discovery and the nodes in this process (default)
+  simulate   run the nodes in a deterministic discrete-event simulation
+  sweep      run seeded simulations for every combination of the -sweep-* ranges and write CSV statistics
+  node       run the nodes, registering to the discovery at -discovery-address
+  discovery  run the discovery at -discovery-address
+
+Run "avalanche-consensus-simulator <command> -h" for the flags of a command.
+`
 
 func main() {
 	log.Build()
-	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
-	var wg sync.WaitGroup
-	discovery, err := runDiscovery()
+	command := "run"
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	var run func(cfg *config.Config) error
+	switch command {
+	case "run":
+		run = runAll
+	case "simulate":
+		run = runSimulation
+	case "sweep":
+		run = runSweep
+	case "node":
+		run = runNodes
+	case "discovery":
+		run = runDiscoveryServer
+	case "help":
+		fmt.Print(usage)
+		return
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	cfg, err := config.Parse(command, args)
+	if err == flag.ErrHelp {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
+	err = run(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runAll runs the discovery and the nodes in this process
+func runAll(cfg *config.Config) error {
+	stopTracing, err := tracing.Start(cfg.Tracing, cfg.ServiceName)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(stopTracing)
+	var network *p2p.MemoryNetwork
+	if cfg.InMemory {
+		network = p2p.NewMemoryNetwork()
+	}
+	identities, err := newIdentities(cfg)
+	if err != nil {
+		return err
+	}
+	validators := cfg.Stake.NodeValidators(identities)
+	discovery, err := runDiscovery(cfg, network, validators)
+	if err != nil {
+		return err
+	}
+	cfg.DiscoveryAddress = discovery.Address
 	time.Sleep(2 * time.Second)
 
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go healthCheckPeers(discovery, sigs)
+	addresses := newNodeAddresses(cfg.NumOfNodes)
+	go runScenario(cfg, discovery, addresses)
+	return startNodes(cfg, network, addresses, identities, validators, sigs)
+}
+
+func runNodes(cfg *config.Config) error {
+	if cfg.InMemory {
+		return fmt.Errorf("the node command connects to the discovery over HTTP, in_memory is only supported by the run command")
+	}
+	if cfg.TLS && cfg.DiscoveryNodeID == "" {
+		return fmt.Errorf("the node command needs the NodeID the discovery logs to verify its certificate over TLS, set discovery_node_id")
+	}
+	if len(cfg.Stake.Weights) > 0 {
+		return errWeightsByIndex
+	}
+	identities, err := newIdentities(cfg)
+	if err != nil {
+		return err
+	}
+	stopTracing, err := tracing.Start(cfg.Tracing, cfg.ServiceName)
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(stopTracing)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	return startNodes(cfg, nil, newNodeAddresses(cfg.NumOfNodes), identities, cfg.Stake.NodeValidators(identities), sigs)
+}
+
+func runDiscoveryServer(cfg *config.Config) error {
+	if len(cfg.Stake.Weights) > 0 {
+		return errWeightsByIndex
+	}
+	stopTracing, err := tracing.Start(cfg.Tracing, cfg.ServiceName+"-discovery")
+	if err != nil {
+		return err
+	}
+	defer shutdownTracing(stopTracing)
+	discovery, err := runDiscovery(cfg, nil, cfg.Stake.NodeValidators(nil))
+	if err != nil {
+		return err
+	}
+	log.Infof("discovery listening on %s", discovery.Address)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	healthCheckPeers(discovery, sigs)
+	return nil
+}
+
+func shutdownTracing(stop func(context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := stop(ctx)
+	if err != nil {
+		log.Errorf("unable to stop the tracing: %v", err)
+	}
+}
+
+func healthCheckPeers(discovery *p2p.Discovery, sigs chan os.Signal) {
 	healthyPeersTicker := time.NewTicker(1 * time.Minute)
-	go func() {
-		for {
-			select {
-			case <-sigs:
-				return
-			case <-healthyPeersTicker.C:
-				err := discovery.HealthCheckPeers()
-				if err != nil {
-					log.Fatal(err)
-				}
+	defer healthyPeersTicker.Stop()
+	for {
+		select {
+		case <-sigs:
+			return
+		case <-healthyPeersTicker.C:
+			err := discovery.HealthCheckPeers()
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
+
+// runScenario starts the times of the scenario once every node has an address
+func runScenario(cfg *config.Config, discovery *p2p.Discovery, addresses *nodeAddresses) {
+	partitions := cfg.Scenario.SimulatorPartitions()
+	if len(partitions) == 0 {
+		return
+	}
+	for !addresses.complete() {
+		time.Sleep(100 * time.Millisecond)
+	}
+	start := time.Now()
+	for _, p := range partitions {
+		time.Sleep(time.Until(start.Add(p.Start)))
+		// the last group holds the nodes in no group of the scenario
+		groups := make([][]string, 0, len(p.Groups)+1)
+		for _, members := range p.Members(cfg.NumOfNodes) {
+			group := make([]string, 0, len(members))
+			for _, j := range members {
+				address, _ := addresses.address(j)
+				group = append(group, address)
+			}
+			if len(group) > 0 {
+				groups = append(groups, group)
 			}
 		}
-	}()
+		discovery.Partition(groups)
+		if p.End == 0 {
+			return
+		}
+		time.Sleep(time.Until(start.Add(p.End)))
+		discovery.Heal()
+	}
+}
+
+type nodeAddresses struct {
+	mu      sync.RWMutex
+	byIndex []string
+	indices map[string]int
+}
+
+func newNodeAddresses(numOfNodes int) *nodeAddresses {
+	return &nodeAddresses{
+		byIndex: make([]string, numOfNodes),
+		indices: make(map[string]int, numOfNodes),
+	}
+}
+
+func (a *nodeAddresses) add(j int, address string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.byIndex[j] = address
+	a.indices[address] = j
+}
+
+func (a *nodeAddresses) address(j int) (string, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.byIndex[j], a.byIndex[j] != ""
+}
+
+func (a *nodeAddresses) complete() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return len(a.indices) == len(a.byIndex)
+}
+
+func (a *nodeAddresses) index(address string) (int, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	j, ok := a.indices[address]
+	return j, ok
+}
+
+// errWeightsByIndex rejects the weights in the commands that do not start every node
+var errWeightsByIndex = errors.New("the node and discovery commands need the stake of the validators by NodeID, the weights by index are only supported by the run command")
+
+func newIdentities(cfg *config.Config) ([]*p2p.Identity, error) {
+	identities := make([]*p2p.Identity, cfg.NumOfNodes)
+	for j := range identities {
+		identity, err := cfg.Stake.Identity(j)
+		if err != nil {
+			return nil, errors.Wrap(err, fmt.Sprintf("unable to get the key of the node %d", j))
+		}
+		identities[j] = identity
+	}
+	return identities, nil
+}
 
-	for j := 0; j < numOfNodes; j++ {
+func startNodes(cfg *config.Config, network *p2p.MemoryNetwork, addresses *nodeAddresses, identities []*p2p.Identity, validators p2p.Validators, sigs chan os.Signal) error {
+	var wg, synced sync.WaitGroup
+	numOfByzantine := cfg.Byzantine.NumOfNodes(cfg.NumOfNodes)
+	logByzantineStake(cfg)
+	honest := newHonestNodes(cfg.NumOfNodes)
+	var conditions p2p.Conditions
+	if !cfg.Network.IsZero() {
+		conditions = cfg.Network.Conditions(cfg.DiscoveryAddress, addresses.index)
+	}
+	// the report covers the snowball and snowman engines
+	var recorder *report.Recorder
+	if cfg.Engine == config.SnowballEngine || cfg.Engine == config.SnowmanEngine {
+		recorder = report.NewWallClockRecorder(cfg.NumOfBlocks)
+		synced.Add(cfg.NumOfNodes)
+		go func() {
+			synced.Wait()
+			err := writeReport(cfg, recorder.Report())
+			if err != nil {
+				log.Errorf("unable to write the report: %v", err)
+			}
+		}()
+	}
+	churn := cfg.Scenario.SimulatorChurn()
+	// the times of the churn start with the nodes
+	started := time.Now()
+	for j := 0; j < cfg.NumOfNodes; j++ {
 		wg.Add(1)
-		go func(j int, discovery *p2p.Discovery) {
+		go func(j int) {
 			doneChan := make(chan bool, 1)
 			defer wg.Done()
 			go func() {
 				<-sigs
 				doneChan <- true
 			}()
-			ctx := context.Background()
-			freePort, err := freeport.GetFreePort()
-			if err != nil {
-				log.Fatal(err)
+			p2pConfig := cfg.P2PConfig(j)
+			if network != nil {
+				p2pConfig.Transport = network.NewTransport(fmt.Sprintf("node-%d", j))
+				addresses.add(j, p2pConfig.Transport.Address())
+			} else {
+				if p2pConfig.Port == 0 {
+					freePort, err := freeport.GetFreePort()
+					if err != nil {
+						log.Fatal(err)
+					}
+					p2pConfig.Port = freePort
+				}
+				host := p2pConfig.Host
+				if host == "" {
+					host = "0.0.0.0"
+				}
+				addresses.add(j, fmt.Sprintf("%s:%d", host, p2pConfig.Port))
 			}
-			p2pConfig := p2p.Config{
-				Name:       serviceName,
-				ProtocolID: protocolID,
-				Host:       host,
-				Port:       freePort,
+			p2pConfig.Conditions = conditions
+			// the node keeps its NodeID when it restarts
+			identity := identities[j]
+			p2pConfig.Identity = identity
+			p2pConfig.Validators = validators
+			log.Infof("node: %d has the NodeID %s and the stake %d", j, identity.NodeID(), validators.Weight(identity.NodeID()))
+			var err error
+			var b *byzantine.Byzantine
+			if j < numOfByzantine {
+				// the values of the blocks of runSnowball are in [0, 2*PossiblePreferences)
+				b, err = byzantine.New(cfg.Byzantine, 2*cfg.PossiblePreferences, random.New(cfg.NodeSeed(j)), honest.view)
+				if err != nil {
+					log.Fatal(err)
+				}
+				p2pConfig.Responder = b.RespondData
 			}
-			parameters := consensus.Parameters{
-				K:     k,
-				Alpha: alpha,
-				Beta:  beta,
+			var nodeRecorder *report.NodeRecorder
+			if recorder != nil && b == nil {
+				nodeRecorder = recorder.Node(j)
 			}
-			n, err := node.InitNode(ctx, chain.Config{
-				P2PConfig:           p2pConfig,
-				ConsensusParameters: parameters,
-			}, discovery)
+			storage, err := cfg.Storage.Open(j)
 			if err != nil {
 				log.Fatal(err)
 			}
-			time.Sleep(1 * time.Second)
-
-			for i := 0; i < numOfBlocks; i++ {
-				data := make([]byte, 0)
-				l := float64(possiblePreferences) * 2
-				r := rand.Intn(int(l))
-				data = append(data, byte(r))
-
-				data = append(data, byte(i))
-				newBlock := &chain.Block{
-					Data: data,
+			var crashes *crashSchedule
+			if b == nil {
+				crashes = newCrashSchedule(cfg, j, started)
+				if churn.IsLateJoiner(j, cfg.NumOfNodes) {
+					log.Infof("node: %d joins in %s", j, churn.JoinAt)
+					time.Sleep(churn.JoinAt)
 				}
-				err := n.Add(newBlock)
+			}
+			// every iteration is a life of the node, it ends with the engine or with a crash
+			var n *node.Node
+			for {
+				if network != nil {
+					// a closed memory transport cannot be started again
+					p2pConfig.Transport = network.NewTransport(p2pConfig.Transport.Address())
+				}
+				n, err = node.InitNode(context.Background(), chain.Config{
+					P2PConfig:           p2pConfig,
+					ConsensusParameters: cfg.Consensus,
+					Concurrency:         cfg.Concurrency,
+					Seed:                cfg.NodeSeed(j),
+					Recorder:            nodeRecorder,
+					Storage:             storage,
+				})
 				if err != nil {
 					log.Fatal(err)
 				}
-			}
-			beforeBlockChainState := ""
-			for _, b := range n.Blocks {
-				data := b.Data[0]
-				beforeBlockChainState += fmt.Sprintf("%d", data)
-			}
-			log.Infof("Before sync, data of node: %d is %s", j, beforeBlockChainState)
+				if len(n.Blocks) > 0 {
+					log.Infof("node: %d reloaded %d blocks from the storage", j, len(n.Blocks))
+				}
+				if b != nil {
+					n.Avalanche.SetResponder(b.RespondChit)
+					log.Infof("node: %d is byzantine with the %s strategy", j, b.Strategy())
+				} else {
+					honest.add(j, n)
+				}
+				time.Sleep(1 * time.Second)
 
-			err = n.Sync(ctx)
+				ctx, cancel := context.WithCancel(context.Background())
+				engineDone := make(chan error, 1)
+				go func() {
+					engineDone <- runEngine(ctx, cfg, j, n)
+				}()
+				crash := crashes.next()
+				select {
+				case err = <-engineDone:
+					cancel()
+				case <-crash.timer.C:
+					cancel()
+					<-engineDone
+					err = n.Client().Close()
+					if err != nil {
+						log.Errorf("unable to stop the node %d: %v", j, err)
+					}
+					if !crash.restart {
+						log.Infof("node: %d crashed and does not restart", j)
+						if cfg.Engine != config.AvalancheEngine {
+							synced.Done()
+						}
+						<-doneChan
+						_ = n.Close()
+						return
+					}
+					log.Infof("node: %d crashed, it restarts in %s", j, crash.downtime)
+					time.Sleep(crash.downtime)
+					continue
+				}
+				crash.timer.Stop()
+				break
+			}
 			if err != nil {
 				log.Fatal(err)
 			}
-			blockChainState := ""
-			for _, b := range n.Blocks {
-				data := b.Data[0]
-				blockChainState += fmt.Sprintf("%d", data)
+			if cfg.Engine != config.AvalancheEngine {
+				synced.Done()
 			}
-			log.Infof("client: %d, block: %s", j, blockChainState)
 
 			<-doneChan
-		}(j, discovery)
+			err = n.Close()
+			if err != nil {
+				log.Errorf("unable to close the storage of the node %d: %v", j, err)
+			}
+		}(j)
 	}
 	wg.Wait()
+	return nil
+}
+
+func runEngine(ctx context.Context, cfg *config.Config, j int, n *node.Node) error {
+	switch cfg.Engine {
+	case config.AvalancheEngine:
+		return runAvalanche(ctx, cfg, j, n)
+	case config.SnowmanEngine:
+		return runSnowman(ctx, cfg, j, n)
+	default:
+		return runSnowball(ctx, cfg, j, n)
+	}
+}
+
+type crashSchedule struct {
+	churn   simulator.Churn
+	node    int
+	started time.Time
+	rand    *rand.Rand
+}
+
+// the timer of nodeCrash fires when the node crashes
+type nodeCrash struct {
+	timer    *time.Timer
+	restart  bool
+	downtime time.Duration
+}
+
+func newCrashSchedule(cfg *config.Config, j int, started time.Time) *crashSchedule {
+	return &crashSchedule{
+		churn:   cfg.Scenario.SimulatorChurn(),
+		node:    j,
+		started: started,
+		rand:    random.New(cfg.NodeSeed(j)),
+	}
+}
+
+// next never fires the timer when the schedule is nil or the node does not crash anymore
+func (s *crashSchedule) next() nodeCrash {
+	crash := nodeCrash{
+		timer: time.NewTimer(time.Duration(math.MaxInt64)),
+	}
+	if s == nil {
+		return crash
+	}
+	at := time.Duration(math.MaxInt64)
+	elapsed := time.Since(s.started)
+	for _, c := range s.churn.Crashes {
+		if c.Node != s.node || c.Start < elapsed || c.Start >= at {
+			continue
+		}
+		at = c.Start
+		crash.restart = c.End > 0
+		crash.downtime = c.End - c.Start
+	}
+	if s.churn.Rate > 0 {
+		if randomAt := elapsed + s.churn.NextCrash(s.rand); randomAt < at {
+			at = randomAt
+			crash.restart = true
+			crash.downtime = s.churn.Downtime
+		}
+	}
+	crash.timer.Reset(at - elapsed)
+	return crash
+}
+
+// honestNodes are the honest nodes of this process, the byzantine nodes of a balancing attack watch them
+type honestNodes struct {
+	mu    sync.Mutex
+	nodes []*node.Node
+}
+
+func newHonestNodes(numOfNodes int) *honestNodes {
+	return &honestNodes{
+		nodes: make([]*node.Node, numOfNodes),
+	}
+}
+
+func (h *honestNodes) add(j int, n *node.Node) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nodes[j] = n
+}
+
+func (h *honestNodes) view(index int) map[byte]int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	counts := make(map[byte]int)
+	for _, n := range h.nodes {
+		if n == nil {
+			continue
+		}
+		data, err := n.BlockData(index)
+		if err != nil || len(data) == 0 {
+			continue
+		}
+		counts[data[0]]++
+	}
+	return counts
+}
+
+// runSnowball keeps the reloaded and the bootstrapped blocks and only adds the missing ones
+func runSnowball(ctx context.Context, cfg *config.Config, j int, n *node.Node) error {
+	err := n.Bootstrapper.Bootstrap(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to bootstrap the chain")
+	}
+	r := random.New(cfg.NodeSeed(j))
+	for i := len(n.Blocks); i < cfg.NumOfBlocks; i++ {
+		data := make([]byte, 0)
+		l := float64(cfg.PossiblePreferences) * 2
+		data = append(data, byte(r.Intn(int(l))))
 
+		data = append(data, byte(i))
+		// the same data gives the same hash at every node
+		newBlock := chain.NewBlock(n.LastBlock(), data, 0)
+		err := n.Add(newBlock)
+		if err != nil {
+			return err
+		}
+	}
+	beforeBlockChainState := ""
+	for _, b := range n.Blocks {
+		data := b.Data[0]
+		beforeBlockChainState += fmt.Sprintf("%d", data)
+	}
+	log.Infof("Before sync, data of node: %d is %s", j, beforeBlockChainState)
+
+	err = n.Sync(ctx)
+	if err != nil {
+		return err
+	}
+	err = n.Verify()
+	if err != nil {
+		return errors.Wrap(err, "the chain is broken after the sync")
+	}
+	blockChainState := ""
+	for _, b := range n.Blocks {
+		data := b.Data[0]
+		blockChainState += fmt.Sprintf("%d", data)
+	}
+	log.Infof("client: %d, block: %s", j, blockChainState)
+	return nil
 }
 
-func runDiscovery() (*p2p.Discovery, error) {
-	discovery := p2p.InitDiscovery()
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
-	discovery.Router(r)
-	go func() {
-		err := r.Run(discovery.Address)
+// runAvalanche issues a transaction spending one of the shared inputs and runs Avalanche until every known transaction is decided
+func runAvalanche(ctx context.Context, cfg *config.Config, j int, n *node.Node) error {
+	input := fmt.Sprintf("utxo-%d", j%cfg.NumOfUTXOs)
+	tx := avalanche.NewTx([]string{input}, []byte(fmt.Sprintf("node-%d", j)))
+	err := n.Avalanche.Issue(ctx, tx)
+	if err != nil {
+		return err
+	}
+	// let the conflicting transactions of the other nodes arrive before polling
+	time.Sleep(5 * time.Second)
+
+	err = n.Avalanche.Run(ctx)
+	if err != nil {
+		return err
+	}
+	dagState := ""
+	for _, input := range n.Avalanche.DAG().Inputs() {
+		acceptedTx, ok := n.Avalanche.DAG().AcceptedTx(input)
+		if !ok {
+			dagState += fmt.Sprintf(" %s=none", input)
+			continue
+		}
+		dagState += fmt.Sprintf(" %s=%s", input, acceptedTx.Data)
+	}
+	log.Infof("client: %d, accepted transactions:%s", j, dagState)
+	return nil
+}
+
+// runSnowman bootstraps first, so a reloaded chain or a late joiner resumes after the last block accepted by the peers
+func runSnowman(ctx context.Context, cfg *config.Config, j int, n *node.Node) error {
+	if n.LastBlock() == nil {
+		err := n.Add(chain.NewBlock(nil, []byte("genesis"), 0))
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-	}()
+		err = n.Decide(0)
+		if err != nil {
+			return err
+		}
+	}
+	err := n.Bootstrapper.Bootstrap(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to bootstrap the chain")
+	}
+	var propose func(parent *chain.Block) *chain.Block
+	if j < cfg.NumOfProposers {
+		propose = func(parent *chain.Block) *chain.Block {
+			data := []byte(fmt.Sprintf("node-%d/%d", j, parent.Height+1))
+			return chain.NewBlock(parent, data, time.Now().Unix())
+		}
+	}
+	err = n.Snowman.Run(ctx, cfg.NumOfBlocks, propose)
+	if err != nil {
+		return err
+	}
+	err = n.Verify()
+	if err != nil {
+		return errors.Wrap(err, "the chain is broken after the consensus")
+	}
+	blockChainState := ""
+	for _, b := range n.Blocks[1:] {
+		blockChainState += fmt.Sprintf(" %s", b.Data)
+	}
+	log.Infof("client: %d, rejected blocks: %d, accepted blocks:%s", j, n.Snowman.Rejected(), blockChainState)
+	return nil
+}
+
+func runSimulation(cfg *config.Config) error {
+	if cfg.Engine != config.SnowballEngine {
+		return fmt.Errorf("the simulation only supports the %s engine", config.SnowballEngine)
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logByzantineStake(cfg)
+	simulation, err := simulator.NewSimulation(cfg.SimulatorConfig(seed), os.Stdout)
+	if err != nil {
+		return err
+	}
+	result, err := simulation.Run()
+	if err != nil {
+		return err
+	}
+	log.Infof("simulation with seed %d finished after %s of virtual time", result.Seed, result.Duration)
+	if !result.Finished {
+		log.Warnf("some nodes did not decide every block before the max time")
+	}
+	return writeReport(cfg, result.Report)
+}
+
+func logByzantineStake(cfg *config.Config) {
+	numOfByzantine := cfg.Byzantine.NumOfNodes(cfg.NumOfNodes)
+	if cfg.Stake.IsZero() || numOfByzantine == 0 {
+		return
+	}
+	log.Infof("%d byzantine nodes hold %.1f%% of the stake", numOfByzantine, 100*cfg.Stake.Share(numOfByzantine, cfg.NumOfNodes))
+}
+
+func runSweep(cfg *config.Config) error {
+	if cfg.Engine != config.SnowballEngine {
+		return fmt.Errorf("the sweep only supports the %s engine", config.SnowballEngine)
+	}
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	base := cfg.SimulatorConfig(seed)
+	if base.MaxTime == 0 {
+		// a cell that never converges would block the sweep
+		base.MaxTime = defaultSweepMaxTime
+		log.Infof("the max time of every simulation of the sweep is %s", base.MaxTime)
+	}
+	cells, skipped := cfg.SweepCells()
+	if skipped > 0 {
+		log.Warnf("%d combinations of the sweep have invalid parameters and are skipped", skipped)
+	}
+	if len(cells) == 0 {
+		return fmt.Errorf("the sweep has no valid combination of parameters")
+	}
+	log.Infof("sweeping %d cells with %d runs each from the seed %d", len(cells), cfg.Sweep.Repeats, seed)
+	results, err := simulator.Sweep(base, cells, cfg.Sweep.Repeats, runtime.NumCPU())
+	if err != nil {
+		return err
+	}
+	if cfg.Sweep.Output == "" {
+		return simulator.WriteCSV(os.Stdout, results)
+	}
+	f, err := os.Create(cfg.Sweep.Output)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	err = simulator.WriteCSV(f, results)
+	if err != nil {
+		return err
+	}
+	log.Infof("the results of the sweep were written to %s", cfg.Sweep.Output)
+	return nil
+}
+
+func writeReport(cfg *config.Config, r *report.Report) error {
+	for _, line := range strings.Split(strings.TrimSpace(r.Summary()), "\n") {
+		log.Info(line)
+	}
+	if cfg.Report == "" {
+		return nil
+	}
+	err := r.WriteJSON(cfg.Report)
+	if err != nil {
+		return err
+	}
+	log.Infof("the report was written to %s", cfg.Report)
+	return nil
+}
+
+// runDiscovery serves over HTTP when the network is nil
+func runDiscovery(cfg *config.Config, network *p2p.MemoryNetwork, validators p2p.Validators) (*p2p.Discovery, error) {
+	var transport p2p.Transport
+	if network != nil {
+		transport = network.NewTransport("discovery")
+	} else {
+		transport = p2p.NewHTTPTransport(cfg.DiscoveryAddress)
+	}
+	discovery := p2p.InitDiscovery(transport)
+	discovery.SetValidators(validators)
+	discovery.SetAdminToken(cfg.DiscoveryAdminToken)
+	identity, err := cfg.Stake.DiscoveryIdentity()
+	if err != nil {
+		return nil, err
+	}
+	discovery.SetIdentity(identity)
+	if httpTransport, ok := transport.(*p2p.HTTPTransport); ok && cfg.TLS {
+		// a node registers its record with the certificate it is bound to
+		err = httpTransport.EnableTLS(identity, discovery.NodeID, discovery.PeerAddress, "register-peer")
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to enable the TLS of the discovery")
+		}
+	}
+	cfg.DiscoveryNodeID = identity.NodeID()
+	log.Infof("discovery has the NodeID %s, the nodes pin it with -discovery-node-id %s", identity.NodeID(), identity.NodeID())
+	err = discovery.Start()
+	if err != nil {
+		return nil, err
+	}
 	return discovery, nil
 }
@@ -3,3 +3,9 @@ package model
 type GetBlockDataByIndexRequest struct {
 	Index int `json:"index"`
 }
+
+type GetBlockDataByIndicesRequest struct {
+	Indices []int `json:"indices"`
+}
+
+type GetBlockDataByIndicesResponse map[int][]byte
@@ -2,155 +2,442 @@ package p2p
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"github.com/gin-gonic/gin"
-	"github.com/go-resty/resty/v2"
-	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	"github.com/tiennampham23/avalanche-consensus-simulator/model"
 	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
-	"net/http"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/metrics"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"sync"
 	"time"
 )
 
+var tracer = otel.Tracer("github.com/tiennampham23/avalanche-consensus-simulator/network/p2p")
+
+const MaxIndices = 1024
+
 type Client struct {
-	cfg                   Config
-	client                *Peer
-	peers                 []*Peer
-	r                     *gin.Engine
+	cfg      Config
+	client   *Peer
+	identity *Identity
+	mu       sync.Mutex
+	peers    []*Peer
+	verified map[string]bool
+	// seqs are the highest seqs by NodeID
+	seqs map[string]uint64
+	// the first response pins discoveryNodeID when it is empty
+	discoveryNodeID       string
+	transport             Transport
 	peerChan              chan *Peer
 	getBlockDataByIndexCb func(int) ([]byte, error)
-	discovery             *Discovery
-	resty                 *resty.Client
+	metrics               *metrics.Node
 }
 
-func (c *Client) ReceiveMessage(r *gin.Context) {
-	r.JSON(200, "OK")
+func (c *Client) ReceiveMessage(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	return json.Marshal("OK")
 }
 
-func (c *Client) GetDataByIndex(r *gin.Context) {
+func (c *Client) GetDataByIndex(ctx context.Context, from string, payload []byte) ([]byte, error) {
 	var req model.GetBlockDataByIndexRequest
-	if err := r.ShouldBindJSON(&req); err != nil {
-		r.JSON(400, nil)
-		return
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the request")
 	}
 	blockData, err := c.getBlockDataByIndexCb(req.Index)
 	if err != nil {
-		r.JSON(400, nil)
-		return
+		return nil, err
+	}
+	blockData, ok := c.respond(from, req.Index, blockData)
+	if !ok {
+		return nil, errors.New("the peer does not answer")
+	}
+	return json.Marshal(blockData)
+}
+
+// GetDataByIndices leaves out the blocks the client does not have
+func (c *Client) GetDataByIndices(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req model.GetBlockDataByIndicesRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the request")
 	}
-	r.JSON(200, blockData)
+	if len(req.Indices) > MaxIndices {
+		return nil, fmt.Errorf("indices = %d: fails the condition that: indices <= %d", len(req.Indices), MaxIndices)
+	}
+	resp := make(model.GetBlockDataByIndicesResponse, len(req.Indices))
+	for _, index := range req.Indices {
+		blockData, err := c.getBlockDataByIndexCb(index)
+		if err != nil {
+			continue
+		}
+		blockData, ok := c.respond(from, index, blockData)
+		if !ok {
+			continue
+		}
+		resp[index] = blockData
+	}
+	return json.Marshal(resp)
 }
 
-func (c *Client) Liveliness(r *gin.Context) {
-	r.JSON(200, nil)
+func (c *Client) respond(from string, index int, blockData []byte) ([]byte, bool) {
+	if c.cfg.Responder == nil {
+		return blockData, true
+	}
+	return c.cfg.Responder(from, index, blockData)
 }
 
-func (c *Client) Router(r *gin.Engine) {
-	r.GET("/receive-msg", c.ReceiveMessage)
-	r.POST("/get-data-by-index", c.GetDataByIndex)
-	r.GET("/liveliness", c.Liveliness)
+func (c *Client) Liveliness(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	return json.Marshal(nil)
 }
 
-func InitClient(ctx context.Context, cfg Config, discovery *Discovery, getBlockDataByIndexCb func(int) ([]byte, error)) (*Client, error) {
+func (c *Client) Router(t Transport) {
+	t.Register("receive-msg", c.ReceiveMessage)
+	t.Register("get-data-by-index", c.GetDataByIndex)
+	t.Register("get-data-by-indices", c.GetDataByIndices)
+	t.Register("liveliness", c.Liveliness)
+}
+
+// InitClient signs every response with the identity of the config, which is also the certificate of the HTTP transport with TLS
+func InitClient(ctx context.Context, cfg Config, getBlockDataByIndexCb func(int) ([]byte, error), routers ...Router) (*Client, error) {
 	if cfg.Host == "" {
 		cfg.Host = "0.0.0.0"
 	}
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.New()
-	restyClient := resty.
-		New().
-		SetRetryCount(5).
-		SetRetryWaitTime(2 * time.Second).
-		AddRetryCondition(func(response *resty.Response, err error) bool {
-			return response.StatusCode() == http.StatusTooManyRequests ||
-				response.StatusCode() == http.StatusGatewayTimeout ||
-				response.StatusCode() == http.StatusServiceUnavailable ||
-				response.StatusCode() == http.StatusBadGateway ||
-				response.StatusCode() == http.StatusInternalServerError
-		})
+	identity := cfg.Identity
+	if identity == nil {
+		var err error
+		identity, err = NewIdentity()
+		if err != nil {
+			return nil, err
+		}
+	}
 	client := &Client{
 		cfg:                   cfg,
+		identity:              identity,
 		getBlockDataByIndexCb: getBlockDataByIndexCb,
 		peers:                 make([]*Peer, 0),
-		r:                     r,
-		discovery:             discovery,
-		resty:                 restyClient,
+		verified:              make(map[string]bool),
+		seqs:                  make(map[string]uint64),
+		discoveryNodeID:       cfg.DiscoveryNodeID,
+		metrics:               metrics.NewNode(),
+	}
+	transport := cfg.Transport
+	if transport == nil {
+		httpTransport := NewHTTPTransport(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port))
+		if cfg.TLS {
+			if cfg.DiscoveryNodeID == "" {
+				return nil, errors.New("the NodeID of the discovery is needed to verify its certificate over TLS")
+			}
+			err := httpTransport.EnableTLS(identity, client.knownNodeID, client.knownAddress)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to enable the TLS")
+			}
+		}
+		transport = httpTransport
+	}
+	serveHTTP(transport, "/metrics", client.metrics.Handler())
+	serveHTTP(transport, "/traces", tracing.Handler())
+	if cfg.Conditions != nil {
+		transport = NewConditionedTransport(transport, cfg.Conditions)
+	}
+	transport = newSignedTransport(transport, identity)
+	client.transport = transport
+	client.Router(transport)
+	for _, router := range routers {
+		router.Router(transport)
 	}
-	client.Router(r)
 
 	p2pClient, err := client.InitP2P()
 	if err != nil {
-		return nil, errors.Wrap(err, fmt.Sprintf("unable to start the client with host: %s, port: %d", cfg.Host, cfg.Port))
+		return nil, errors.Wrap(err, fmt.Sprintf("unable to start the client with address: %s", transport.Address()))
 	}
 	client.client = p2pClient
 
-	log.Infof("Init P2P Client successfully, host: %s, port: %d", cfg.Host, cfg.Port)
+	log.Infof("Init P2P Client successfully, address: %s", transport.Address())
 
 	// Discovery other node
 	peers, err := client.RegisterDiscovery(ctx, p2pClient)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to register the peer to the discovery")
 	}
-	client.peers = peers
+	client.setPeers(peers)
 
 	return client, nil
 }
 
 func (c *Client) InitP2P() (*Peer, error) {
-	address := fmt.Sprintf("%s:%d", c.cfg.Host, c.cfg.Port)
-	p := &Peer{
-		Address: address,
-		ID:      uuid.New().String(),
+	p := newPeer(c.transport.Address(), c.cfg.Validators.Weight(c.identity.NodeID()), c.identity)
+	err := c.transport.Start()
+	if err != nil {
+		return nil, err
 	}
-	go func() {
-		err := c.r.Run(address)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}()
 	return p, nil
 }
 
 func (c *Client) RegisterDiscovery(ctx context.Context, peer *Peer) ([]*Peer, error) {
-	resp, err := c.resty.R().SetBody(map[string]interface{}{
-		"peer": peer,
-	}).Post(fmt.Sprintf("http://%s/register-peer", c.discovery.Address))
+	var response RegisterPeerResponse
+	err := c.discoveryRequest(ctx, "register-peer", RegisterPeerRequest{
+		Peer: peer,
+	}, &response)
 	if err != nil {
 		return nil, err
 	}
+	peers := c.verifyPeers(response.Peer)
+	c.metrics.SetPeers(len(peers))
+	return peers, nil
+}
+
+func (c *Client) GetBlockData(ctx context.Context, peer *Peer, req model.GetBlockDataByIndexRequest) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "Client.GetBlockData", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("peer.address", peer.Address),
+		attribute.Int("chain.index", req.Index),
+	))
+	defer span.End()
+	var blockData []byte
+	err := c.Request(ctx, peer, "get-data-by-index", req, &blockData)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "the request failed")
+		return nil, err
+	}
+	return blockData, nil
+}
+
+func (c *Client) GetBlocksData(ctx context.Context, peer *Peer, req model.GetBlockDataByIndicesRequest) (model.GetBlockDataByIndicesResponse, error) {
+	ctx, span := tracer.Start(ctx, "Client.GetBlocksData", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("peer.address", peer.Address),
+		attribute.IntSlice("chain.indices", req.Indices),
+	))
+	defer span.End()
+	var blocksData model.GetBlockDataByIndicesResponse
+	err := c.Request(ctx, peer, "get-data-by-indices", req, &blocksData)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "the request failed")
+		return nil, err
+	}
+	return blocksData, nil
+}
+
+func (c *Client) Peers() ([]*Peer, error) {
 	var response struct {
 		Peers []*Peer `json:"peers"`
 	}
-	err = json.Unmarshal(resp.Body(), &response)
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, errors.Wrap(err, "unable to generate the nonce of the request")
+	}
+	err := c.discoveryRequest(context.Background(), "peers", PeersRequest{Nonce: nonce}, &response)
 	if err != nil {
 		return nil, err
 	}
-	return response.Peers, nil
+	peers := c.verifyPeers(response.Peers)
+	c.setPeers(peers)
+	c.metrics.SetPeers(len(peers))
+	return peers, nil
 }
 
-func (c *Client) GetBlockData(ctx context.Context, peer *Peer, req model.GetBlockDataByIndexRequest) ([]byte, error) {
-	resp, err := c.resty.R().SetBody(req).Post(fmt.Sprintf("http://%s/get-data-by-index", peer.Address))
+// verifyPeers leaves out the unsigned, mis-staked and older records
+func (c *Client) verifyPeers(peers []*Peer) []*Peer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	verified := make([]*Peer, 0, len(peers))
+	for _, peer := range peers {
+		if peer == nil {
+			continue
+		}
+		if err := c.cfg.Validators.Verify(peer); err != nil {
+			log.Debugf("the peer %s is left out: %v", peer.Address, err)
+			continue
+		}
+		// a record is verified again when its content or its signature changes
+		digest := sha256.Sum256(peer.message())
+		key := string(digest[:]) + string(peer.Signature)
+		if !c.verified[key] {
+			err := peer.Verify()
+			if err != nil {
+				log.Debugf("the peer %s is left out: %v", peer.Address, err)
+				continue
+			}
+			c.verified[key] = true
+		}
+		if peer.Seq < c.seqs[peer.ID] {
+			log.Debugf("the peer %s is left out: its record is older than the seq %d", peer.Address, c.seqs[peer.ID])
+			continue
+		}
+		c.seqs[peer.ID] = peer.Seq
+		verified = append(verified, peer)
+	}
+	return verified
+}
+
+func (c *Client) setPeers(peers []*Peer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.peers = peers
+}
+
+// publicKey fetches the peers again when the address is unknown
+func (c *Client) publicKey(peer *Peer) ([]byte, error) {
+	if len(peer.PublicKey) > 0 {
+		return peer.PublicKey, nil
+	}
+	if publicKey, ok := c.knownPublicKey(peer.Address); ok {
+		return publicKey, nil
+	}
+	_, err := c.Peers()
 	if err != nil {
-		return nil, err
+		return nil, errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	if publicKey, ok := c.knownPublicKey(peer.Address); ok {
+		return publicKey, nil
 	}
-	return resp.Body(), nil
+	return nil, fmt.Errorf("the peer %s is unknown", peer.Address)
+}
 
+func (c *Client) knownPublicKey(address string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, p := range c.peers {
+		if p.Address == address {
+			return p.PublicKey, true
+		}
+	}
+	return nil, false
 }
 
-func (c *Client) Peers() ([]*Peer, error) {
-	resp, err := c.resty.R().Get(fmt.Sprintf("http://%s/peers", c.discovery.Address))
+func (c *Client) knownNodeID(address string) (string, bool) {
+	if address == c.cfg.DiscoveryAddress {
+		return c.cfg.DiscoveryNodeID, true
+	}
+	return c.lookupPeer(func(p *Peer) (string, bool) {
+		return p.ID, p.Address == address
+	})
+}
+
+func (c *Client) knownAddress(nodeID string) (string, bool) {
+	if nodeID == c.cfg.DiscoveryNodeID {
+		return c.cfg.DiscoveryAddress, true
+	}
+	return c.lookupPeer(func(p *Peer) (string, bool) {
+		return p.Address, p.ID == nodeID
+	})
+}
+
+// lookupPeer fetches the peers again when no verified peer matches
+func (c *Client) lookupPeer(match func(p *Peer) (string, bool)) (string, bool) {
+	find := func() (string, bool) {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		for _, p := range c.peers {
+			if value, ok := match(p); ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	if value, ok := find(); ok {
+		return value, true
+	}
+	if _, err := c.Peers(); err != nil {
+		return "", false
+	}
+	return find()
+}
+
+func (c *Client) Peer() *Peer {
+	return c.client
+}
+
+func (c *Client) Transport() Transport {
+	return c.transport
+}
+
+// Request rejects a response that is not signed with the key of the peer
+func (c *Client) Request(ctx context.Context, peer *Peer, route string, req interface{}, resp interface{}) error {
+	start := time.Now()
+	err := c.request(ctx, peer, route, req, resp)
+	c.metrics.ObserveRequest(route, time.Since(start), err)
+	return err
+}
+
+func (c *Client) request(ctx context.Context, peer *Peer, route string, req interface{}, resp interface{}) error {
+	publicKey, err := c.publicKey(peer)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	var response struct {
-		Peers []*Peer `json:"peers"`
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the request")
 	}
-	err = json.Unmarshal(resp.Body(), &response)
+	respPayload, err := c.transport.Request(ctx, peer.Address, route, payload)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	var signed SignedResponse
+	err = json.Unmarshal(respPayload, &signed)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode the signed response")
+	}
+	if !verifySignature(publicKey, responseMessage(route, c.transport.Address(), payload, signed.Payload), signed.Signature) {
+		return fmt.Errorf("the response of %s is not signed with the key of the peer", peer.Address)
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(signed.Payload, resp)
+}
+
+func (c *Client) discoveryRequest(ctx context.Context, route string, req interface{}, resp interface{}) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the request")
+	}
+	respPayload, err := c.transport.Request(ctx, c.cfg.DiscoveryAddress, route, payload)
+	if err != nil {
+		return err
+	}
+	var signed SignedResponse
+	err = json.Unmarshal(respPayload, &signed)
+	if err != nil {
+		return errors.Wrap(err, "unable to decode the signed response")
+	}
+	if !verifySignature(signed.PublicKey, responseMessage(route, "", payload, signed.Payload), signed.Signature) {
+		return errors.New("the response of the discovery is not signed with its key")
+	}
+	nodeID := NodeID(signed.PublicKey)
+	c.mu.Lock()
+	if c.discoveryNodeID == "" {
+		log.Warnf("the discovery %s is trusted on first use with the NodeID %s, set the NodeID of the discovery to pin it", c.cfg.DiscoveryAddress, nodeID)
+		c.discoveryNodeID = nodeID
+	}
+	pinned := c.discoveryNodeID
+	c.mu.Unlock()
+	if nodeID != pinned {
+		return fmt.Errorf("the response of the discovery is signed by %s instead of %s", nodeID, pinned)
 	}
-	c.peers = response.Peers
-	return response.Peers, nil
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(signed.Payload, resp)
+}
+
+func (c *Client) Send(ctx context.Context, peer *Peer, route string, req interface{}) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the request")
+	}
+	return c.transport.Send(ctx, peer.Address, route, payload)
+}
+
+func (c *Client) Metrics() *metrics.Node {
+	return c.metrics
+}
+
+func (c *Client) Close() error {
+	return c.transport.Close()
 }
@@ -0,0 +1,122 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/model"
+)
+
+func TestClientVerifyPeers(t *testing.T) {
+	identity, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{
+		verified: make(map[string]bool),
+		seqs:     make(map[string]uint64),
+	}
+	peer := newPeer("node-0", 1, identity)
+	if verified := c.verifyPeers([]*Peer{peer}); len(verified) != 1 {
+		t.Fatal("the signed record of the peer is left out")
+	}
+
+	// the signature of the verified record is reused for records with another content
+	tests := []struct {
+		name  string
+		forge func(p *Peer)
+	}{
+		{name: "another weight", forge: func(p *Peer) { p.Weight = 100 }},
+		{name: "another address", forge: func(p *Peer) { p.Address = "node-1" }},
+		{name: "another key", forge: func(p *Peer) {
+			other, _ := NewIdentity()
+			p.PublicKey = other.PublicKey()
+			p.ID = other.NodeID()
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forged := *peer
+			tt.forge(&forged)
+			if verified := c.verifyPeers([]*Peer{&forged}); len(verified) != 0 {
+				t.Error("the forged record with the signature of a verified record is kept")
+			}
+		})
+	}
+	if verified := c.verifyPeers([]*Peer{peer}); len(verified) != 1 {
+		t.Error("the verified record is left out")
+	}
+
+	newer := newPeer("node-1", 1, identity)
+	if verified := c.verifyPeers([]*Peer{newer}); len(verified) != 1 {
+		t.Fatal("the newer record of the peer is left out")
+	}
+	if verified := c.verifyPeers([]*Peer{peer}); len(verified) != 0 {
+		t.Error("the older record of the peer is kept after the newer one")
+	}
+}
+
+func TestClientVerifyPeersChecksTheStake(t *testing.T) {
+	validator, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Client{
+		cfg: Config{
+			Validators: Validators{validator.NodeID(): 5},
+		},
+		verified: make(map[string]bool),
+		seqs:     make(map[string]uint64),
+	}
+	tests := []struct {
+		name string
+		peer *Peer
+		kept bool
+	}{
+		{name: "a validator with its stake", peer: newPeer("node-0", 5, validator), kept: true},
+		{name: "a validator with another stake", peer: newPeer("node-0", 1, validator)},
+		{name: "a node that is not a validator without stake", peer: newPeer("node-1", 0, other), kept: true},
+		{name: "a node that is not a validator with a stake", peer: newPeer("node-1", 1, other)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if verified := c.verifyPeers([]*Peer{tt.peer}); (len(verified) == 1) != tt.kept {
+				t.Errorf("kept = %v, want %v", len(verified) == 1, tt.kept)
+			}
+		})
+	}
+}
+
+func TestClientGetDataByIndicesCapsTheIndices(t *testing.T) {
+	c := &Client{
+		getBlockDataByIndexCb: func(index int) ([]byte, error) {
+			return []byte{byte(index)}, nil
+		},
+	}
+	tests := []struct {
+		indices int
+		valid   bool
+	}{
+		{indices: MaxIndices, valid: true},
+		{indices: MaxIndices + 1},
+	}
+	for _, tt := range tests {
+		req := model.GetBlockDataByIndicesRequest{}
+		for i := 0; i < tt.indices; i++ {
+			req.Indices = append(req.Indices, i)
+		}
+		payload, err := json.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = c.GetDataByIndices(context.Background(), "node-1", payload)
+		if (err == nil) != tt.valid {
+			t.Errorf("indices = %d: GetDataByIndices() = %v, want valid = %v", tt.indices, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// LinkConditions degrade the messages sent over the link between two peers
+type LinkConditions struct {
+	Latency time.Duration
+	// the delay is uniform in [Latency-Jitter, Latency+Jitter]
+	Jitter          time.Duration
+	DropProbability float64
+	// Bandwidth is in bytes per second, 0 means unlimited
+	Bandwidth int
+}
+
+func (l *LinkConditions) Verify() error {
+	switch {
+	case l.Latency < 0 || l.Jitter < 0:
+		return fmt.Errorf("latency = %s, jitter = %s: fails the condition that: 0 <= latency and 0 <= jitter", l.Latency, l.Jitter)
+	case l.DropProbability < 0 || l.DropProbability > 1:
+		return fmt.Errorf("dropProbability = %v: fails the condition that: 0 <= dropProbability <= 1", l.DropProbability)
+	case l.Bandwidth < 0:
+		return fmt.Errorf("bandwidth = %d: fails the condition that: 0 <= bandwidth", l.Bandwidth)
+	}
+	return nil
+}
+
+// Delay starts transmitting the message at busyUntil when the link is still busy with the previous ones
+func (l *LinkConditions) Delay(r *rand.Rand, now, busyUntil time.Duration, size int) (time.Duration, time.Duration) {
+	start := now
+	if busyUntil > start {
+		start = busyUntil
+	}
+	end := start
+	if l.Bandwidth > 0 {
+		end += time.Duration(int64(size) * int64(time.Second) / int64(l.Bandwidth))
+	}
+	latency := l.Latency
+	if l.Jitter > 0 {
+		latency += time.Duration(r.Int63n(int64(2*l.Jitter)+1)) - l.Jitter
+	}
+	if latency < 0 {
+		latency = 0
+	}
+	return end - now + latency, end
+}
+
+func (l *LinkConditions) Drop(r *rand.Rand) bool {
+	return l.DropProbability > 0 && r.Float64() < l.DropProbability
+}
+
+type Conditions func(from, to string) LinkConditions
+
+type link struct {
+	from string
+	to   string
+}
+
+// ConditionedTransport delays a request and its response, a lost message fails the request
+type ConditionedTransport struct {
+	Transport
+	conditions Conditions
+	mu         sync.Mutex
+	rand       *rand.Rand
+	// start is the time the transport was created, the links are busy until a time since start
+	start     time.Time
+	busyUntil map[link]time.Duration
+}
+
+// NewConditionedTransport seeds with the current time, the delays of a real network are not reproducible
+func NewConditionedTransport(t Transport, conditions Conditions) *ConditionedTransport {
+	return &ConditionedTransport{
+		Transport:  t,
+		conditions: conditions,
+		rand:       random.New(0),
+		start:      time.Now(),
+		busyUntil:  make(map[link]time.Duration),
+	}
+}
+
+func (t *ConditionedTransport) Request(ctx context.Context, address string, route string, payload []byte) ([]byte, error) {
+	err := t.transmit(ctx, t.Address(), address, len(payload))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.Transport.Request(ctx, address, route, payload)
+	if err != nil {
+		return nil, err
+	}
+	// the response travels back over the link from the peer
+	err = t.transmit(ctx, address, t.Address(), len(resp))
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *ConditionedTransport) Send(ctx context.Context, address string, route string, payload []byte) error {
+	go func() {
+		if t.transmit(ctx, t.Address(), address, len(payload)) != nil {
+			return
+		}
+		_ = t.Transport.Send(ctx, address, route, payload)
+	}()
+	return nil
+}
+
+func (t *ConditionedTransport) transmit(ctx context.Context, from, to string, size int) error {
+	conditions := t.conditions(from, to)
+	t.mu.Lock()
+	l := link{from: from, to: to}
+	delay, busyUntil := conditions.Delay(t.rand, time.Since(t.start), t.busyUntil[l], size)
+	t.busyUntil[l] = busyUntil
+	dropped := conditions.Drop(t.rand)
+	t.mu.Unlock()
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if dropped {
+		return fmt.Errorf("the message was lost")
+	}
+	return nil
+}
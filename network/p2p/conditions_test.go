@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func TestLinkConditionsDelay(t *testing.T) {
+	// 1000 bytes per second, a message of 100 bytes takes 100ms to transmit
+	conditions := LinkConditions{Latency: 10 * time.Millisecond, Bandwidth: 1000}
+	tests := []struct {
+		name      string
+		now       time.Duration
+		busyUntil time.Duration
+		delay     time.Duration
+		end       time.Duration
+	}{
+		{
+			name:  "an idle link transmits the message at once",
+			now:   time.Second,
+			delay: 110 * time.Millisecond,
+			end:   time.Second + 100*time.Millisecond,
+		},
+		{
+			name:      "a busy link transmits the message after the previous ones",
+			now:       time.Second,
+			busyUntil: time.Second + 250*time.Millisecond,
+			delay:     360 * time.Millisecond,
+			end:       time.Second + 350*time.Millisecond,
+		},
+		{
+			name:      "a link that finished the previous messages is idle",
+			now:       time.Second,
+			busyUntil: 500 * time.Millisecond,
+			delay:     110 * time.Millisecond,
+			end:       time.Second + 100*time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delay, end := conditions.Delay(rand.New(rand.NewSource(1)), tt.now, tt.busyUntil, 100)
+			if delay != tt.delay || end != tt.end {
+				t.Errorf("delay = %s, busy until %s, want %s and %s", delay, end, tt.delay, tt.end)
+			}
+		})
+	}
+}
+
+func TestLinkConditionsSerializeMessages(t *testing.T) {
+	conditions := LinkConditions{Bandwidth: 1000}
+	r := rand.New(rand.NewSource(1))
+	var busyUntil time.Duration
+	// ten messages of 100 bytes sent at the same time arrive 100ms after each other
+	for i := 1; i <= 10; i++ {
+		var delay time.Duration
+		delay, busyUntil = conditions.Delay(r, 0, busyUntil, 100)
+		if want := time.Duration(i) * 100 * time.Millisecond; delay != want {
+			t.Fatalf("message %d: delay = %s, want %s", i, delay, want)
+		}
+	}
+}
@@ -1,8 +1,23 @@
 package p2p
 
 type Config struct {
-	Name       string
-	ProtocolID string
-	Host       string
-	Port       int
+	Name             string
+	ProtocolID       string
+	Host             string
+	Port             int
+	DiscoveryAddress string
+	// DiscoveryNodeID is needed with TLS
+	DiscoveryNodeID string
+	// the client leaves out the peers registered with another stake than the one of Validators
+	Validators Validators
+	// a new Identity is generated when it is nil
+	Identity *Identity
+	// Responder lets a node misbehave, the peer gets no answer when it returns false
+	Responder func(from string, index int, data []byte) ([]byte, bool)
+	// Conditions degrade the links to the peers when it is set
+	Conditions Conditions
+	// an HTTP transport on Host and Port is used when Transport is nil
+	Transport Transport
+	// TLS does not apply to a transport of the config
+	TLS bool
 }
@@ -1,13 +1,16 @@
 package p2p
 
 import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
-	"github.com/gin-gonic/gin"
-	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
 	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
-	"net/http"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/metrics"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/tracing"
 	"sync"
-	"time"
 )
 
 const (
@@ -16,10 +19,18 @@ const (
 )
 
 type Discovery struct {
-	mu          sync.Mutex
-	Address     string
-	Peers       []*Peer
-	restyClient *resty.Client
+	mu        sync.Mutex
+	Address   string
+	Peers     []*Peer
+	transport Transport
+	// groups is nil when the network is not partitioned
+	groups     map[string]int
+	validators Validators
+	// the nodes pin the NodeID of identity
+	identity *Identity
+	// the admin routes are disabled when adminToken is empty
+	adminToken string
+	metrics    *metrics.Discovery
 }
 
 type RegisterPeerRequest struct {
@@ -30,76 +41,255 @@ type RegisterPeerResponse struct {
 	Peer []*Peer `json:"peers"`
 }
 
-func (d *Discovery) Router(r *gin.Engine) {
-	r.POST("/register-peer", d.RegisterPeer)
-	r.GET("/peers", d.GetPeers)
-}
-
-func InitDiscovery() *Discovery {
-	restyClient := resty.
-		New().
-		SetRetryCount(5).
-		SetRetryWaitTime(2 * time.Second).
-		AddRetryCondition(func(response *resty.Response, err error) bool {
-			return response.StatusCode() == http.StatusTooManyRequests ||
-				response.StatusCode() == http.StatusGatewayTimeout ||
-				response.StatusCode() == http.StatusServiceUnavailable ||
-				response.StatusCode() == http.StatusBadGateway ||
-				response.StatusCode() == http.StatusInternalServerError
-		})
-	address := fmt.Sprintf("%s:%d", DiscoveryHost, DiscoveryPort)
+// the nonce of PeersRequest keeps a signed response from being replayed
+type PeersRequest struct {
+	Nonce []byte `json:"nonce"`
+}
+
+type PartitionRequest struct {
+	Token  string     `json:"token"`
+	Groups [][]string `json:"groups"`
+}
+
+type HealRequest struct {
+	Token string `json:"token"`
+}
+
+func (d *Discovery) Router(t Transport) {
+	t.Register("register-peer", d.RegisterPeer)
+	t.Register("peers", d.GetPeers)
+	t.Register("partition", d.PartitionPeers)
+	t.Register("heal", d.HealPeers)
+}
+
+// InitDiscovery listens on DiscoveryHost and DiscoveryPort when the transport is nil
+func InitDiscovery(transport Transport) *Discovery {
+	if transport == nil {
+		transport = NewHTTPTransport(fmt.Sprintf("%s:%d", DiscoveryHost, DiscoveryPort))
+	}
 	return &Discovery{
-		Address:     address,
-		Peers:       make([]*Peer, 0),
-		restyClient: restyClient,
+		Address:   transport.Address(),
+		Peers:     make([]*Peer, 0),
+		transport: transport,
+		metrics:   metrics.NewDiscovery(),
+	}
+}
+
+func (d *Discovery) SetValidators(validators Validators) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.validators = validators
+}
+
+// Start generates an identity when SetIdentity was not called
+func (d *Discovery) SetIdentity(identity *Identity) {
+	d.identity = identity
+}
+
+func (d *Discovery) Identity() *Identity {
+	return d.identity
+}
+
+func (d *Discovery) SetAdminToken(token string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.adminToken = token
+}
+
+func (d *Discovery) Start() error {
+	if d.identity == nil {
+		identity, err := NewIdentity()
+		if err != nil {
+			return err
+		}
+		d.identity = identity
 	}
+	d.Router(newDiscoveryTransport(d.transport, d.identity))
+	serveHTTP(d.transport, "/metrics", d.metrics.Handler())
+	serveHTTP(d.transport, "/traces", tracing.Handler())
+	return d.transport.Start()
 }
 
-func (d *Discovery) RegisterPeer(c *gin.Context) {
+func (d *Discovery) RegisterPeer(ctx context.Context, from string, payload []byte) ([]byte, error) {
 	var req RegisterPeerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, nil)
+	if err := json.Unmarshal(payload, &req); err != nil || req.Peer == nil {
+		return nil, errors.New("invalid register peer request")
 	}
-	isAvailablePeer := true
-	for _, peer := range d.Peers {
-		if peer.ID == req.Peer.ID {
-			isAvailablePeer = false
+	err := req.Peer.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid peer")
+	}
+	// over TLS the peer registers the NodeID of its certificate
+	if nodeID, ok := PeerNodeID(ctx); ok && nodeID != req.Peer.ID {
+		return nil, fmt.Errorf("the peer registers the NodeID %s with the certificate of %s", req.Peer.ID, nodeID)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.validators.Verify(req.Peer)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid peer")
+	}
+	registered := -1
+	for i, peer := range d.Peers {
+		switch {
+		// a restarted peer registers again with its ID
+		case peer.ID == req.Peer.ID:
+			if req.Peer.Seq < peer.Seq || (req.Peer.Seq == peer.Seq && !bytes.Equal(req.Peer.Signature, peer.Signature)) {
+				return nil, fmt.Errorf("seq = %d, registered seq = %d: fails the condition that: the record is newer than the registered one", req.Peer.Seq, peer.Seq)
+			}
+			registered = i
+		case peer.Address == req.Peer.Address:
+			return nil, fmt.Errorf("the address %s is registered by the peer %s", req.Peer.Address, peer.ID)
 		}
 	}
-	if isAvailablePeer {
+	if registered >= 0 {
+		d.Peers[registered] = req.Peer
+	} else {
 		d.Peers = append(d.Peers, req.Peer)
 	}
-	c.JSON(200, RegisterPeerResponse{
-		Peer: d.Peers,
+	d.metrics.Registered(len(d.Peers))
+	return json.Marshal(RegisterPeerResponse{
+		Peer: d.reachablePeers(req.Peer.Address),
 	})
 }
 
-func (d *Discovery) GetPeers(c *gin.Context) {
-	c.JSON(200, map[string]interface{}{
-		"peers": d.Peers,
+func (d *Discovery) GetPeers(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return json.Marshal(map[string]interface{}{
+		"peers": d.reachablePeers(from),
 	})
 }
 
+func (d *Discovery) PartitionPeers(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req PartitionRequest
+	if err := json.Unmarshal(payload, &req); err != nil || len(req.Groups) == 0 {
+		return nil, errors.New("invalid partition request")
+	}
+	err := d.authorize(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	d.Partition(req.Groups)
+	return json.Marshal("OK")
+}
+
+func (d *Discovery) HealPeers(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req HealRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid heal request")
+	}
+	err := d.authorize(req.Token)
+	if err != nil {
+		return nil, err
+	}
+	d.Heal()
+	return json.Marshal("OK")
+}
+
+func (d *Discovery) authorize(token string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.adminToken == "" {
+		return errors.New("the admin routes are disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(d.adminToken)) != 1 {
+		return errors.New("the admin token is invalid")
+	}
+	return nil
+}
+
+// Partition puts the peers in no group in one more group, a peer only gets the peers of its group
+func (d *Discovery) Partition(groups [][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groups = make(map[string]int)
+	for i, group := range groups {
+		for _, address := range group {
+			d.groups[address] = i
+		}
+	}
+	log.Infof("the peers are partitioned in %d groups", len(groups))
+}
+
+func (d *Discovery) Heal() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.groups = nil
+	log.Info("the partition is healed")
+}
+
+func (d *Discovery) NodeID(address string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, peer := range d.Peers {
+		if peer.Address == address {
+			return peer.ID, true
+		}
+	}
+	return "", false
+}
+
+func (d *Discovery) PeerAddress(nodeID string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, peer := range d.Peers {
+		if peer.ID == nodeID {
+			return peer.Address, true
+		}
+	}
+	return "", false
+}
+
+// reachablePeers must be called with the lock held
+func (d *Discovery) reachablePeers(address string) []*Peer {
+	if d.groups == nil {
+		return d.Peers
+	}
+	peers := make([]*Peer, 0)
+	for _, peer := range d.Peers {
+		if d.group(peer.Address) == d.group(address) {
+			peers = append(peers, peer)
+		}
+	}
+	return peers
+}
+
+func (d *Discovery) group(address string) int {
+	group, ok := d.groups[address]
+	if !ok {
+		return -1
+	}
+	return group
+}
+
 func (d *Discovery) HealthCheckPeers() error {
 	log.Debug("healthy check start")
 	var wg sync.WaitGroup
+	var mu sync.Mutex
 	peers := make([]*Peer, 0)
 
-	for _, p := range d.Peers {
+	d.mu.Lock()
+	registered := d.Peers
+	d.mu.Unlock()
+	for _, p := range registered {
 		wg.Add(1)
-		go func() {
+		go func(p *Peer) {
 			defer wg.Done()
-			_, err := d.restyClient.R().Get(fmt.Sprintf("http://%s/liveliness", p.Address))
+			err := request(context.Background(), d.transport, p.Address, "liveliness", nil, nil)
 			if err != nil {
 				return
 			}
+			mu.Lock()
+			defer mu.Unlock()
 			peers = append(peers, p)
-		}()
+		}(p)
 	}
 	wg.Wait()
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	d.Peers = peers
+	d.metrics.SetPeers(len(peers))
 
 	return nil
 }
@@ -0,0 +1,172 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiscoveryRegisterPeer(t *testing.T) {
+	identities := make([]*Identity, 3)
+	for i := range identities {
+		identity, err := NewIdentity()
+		if err != nil {
+			t.Fatal(err)
+		}
+		identities[i] = identity
+	}
+	// the third node is not a validator
+	validators := Validators{identities[0].NodeID(): 2, identities[1].NodeID(): 1}
+	// the record is older than the records of the table
+	old := newPeer("node-0", 2, identities[0])
+	forged := newPeer("node-2", 2, identities[0])
+	forged.Weight = 100
+
+	tests := []struct {
+		name string
+		peer *Peer
+		// err is a part of the error, the peer is registered when it is empty
+		err string
+	}{
+		{name: "a new peer is registered", peer: newPeer("node-0", 2, identities[0])},
+		{name: "a restarted peer registers again", peer: newPeer("node-0", 2, identities[0])},
+		{name: "a peer moves to a free address", peer: newPeer("node-1", 2, identities[0])},
+		{name: "another peer cannot take a registered address", peer: newPeer("node-1", 1, identities[1]), err: "is registered by the peer"},
+		{name: "a record that is not signed with the key of its ID is rejected", peer: forged, err: "not signed"},
+		{name: "another peer registers at a free address", peer: newPeer("node-0", 1, identities[1])},
+		{name: "an older record of a registered peer is rejected", peer: old, err: "the record is newer than the registered one"},
+		{name: "a validator registering another stake is rejected", peer: newPeer("node-1", 100, identities[0]), err: "registers the stake of its NodeID"},
+		{name: "a node that is not a validator registering a stake is rejected", peer: newPeer("node-2", 1, identities[2]), err: "registers the stake of its NodeID"},
+		{name: "a node that is not a validator registers without stake", peer: newPeer("node-2", 0, identities[2])},
+	}
+	d := InitDiscovery(NewMemoryNetwork().NewTransport("discovery"))
+	d.SetValidators(validators)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload, err := json.Marshal(RegisterPeerRequest{Peer: tt.peer})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = d.RegisterPeer(context.Background(), tt.peer.Address, payload)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id, ok := d.NodeID(tt.peer.Address); !ok || id != tt.peer.ID {
+				t.Errorf("the address %s is registered by %s, want %s", tt.peer.Address, id, tt.peer.ID)
+			}
+		})
+	}
+	if len(d.Peers) != 3 {
+		t.Errorf("%d peers are registered, want 3", len(d.Peers))
+	}
+	for _, peer := range d.Peers {
+		if peer.ID == identities[0].NodeID() && (peer.Address != "node-1" || peer.Weight != 2) {
+			t.Errorf("the first peer is registered as %s with the weight %d, want node-1 with the weight 2", peer.Address, peer.Weight)
+		}
+	}
+}
+
+func TestDiscoveryAdminRoutes(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminToken string
+		token      string
+		// the routes are authorized when err is empty
+		err string
+	}{
+		{name: "the routes are disabled without an admin token", token: "secret", err: "disabled"},
+		{name: "another token is rejected", adminToken: "secret", token: "guess", err: "invalid"},
+		{name: "the admin token is authorized", adminToken: "secret", token: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := InitDiscovery(NewMemoryNetwork().NewTransport("discovery"))
+			d.SetAdminToken(tt.adminToken)
+			partition, err := json.Marshal(PartitionRequest{Token: tt.token, Groups: [][]string{{"node-0"}}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			heal, err := json.Marshal(HealRequest{Token: tt.token})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = d.PartitionPeers(context.Background(), "node-1", partition)
+			partitioned := d.groups != nil
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("PartitionPeers() = %v, want %q", err, tt.err)
+				}
+				if partitioned {
+					t.Error("the unauthorized request partitioned the peers")
+				}
+				if _, err := d.HealPeers(context.Background(), "node-1", heal); err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("HealPeers() = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil || !partitioned {
+				t.Fatalf("PartitionPeers() = %v, partitioned = %v", err, partitioned)
+			}
+			if _, err := d.HealPeers(context.Background(), "node-1", heal); err != nil || d.groups != nil {
+				t.Fatalf("HealPeers() = %v, healed = %v", err, d.groups == nil)
+			}
+		})
+	}
+}
+
+func TestClientPinsTheDiscovery(t *testing.T) {
+	network := NewMemoryNetwork()
+	d := InitDiscovery(network.NewTransport("discovery"))
+	identity, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetIdentity(identity)
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	other, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name            string
+		discoveryNodeID string
+		valid           bool
+	}{
+		{name: "the pinned NodeID of the discovery", discoveryNodeID: identity.NodeID(), valid: true},
+		{name: "the first discovery is trusted without a pinned NodeID", valid: true},
+		{name: "another pinned NodeID", discoveryNodeID: other.NodeID()},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := InitClient(context.Background(), Config{
+				DiscoveryAddress: d.Address,
+				DiscoveryNodeID:  tt.discoveryNodeID,
+				Transport:        network.NewTransport(fmt.Sprintf("node-%d", i)),
+			}, func(int) ([]byte, error) {
+				return nil, nil
+			})
+			if c != nil {
+				defer c.Close()
+			}
+			if (err == nil) != tt.valid {
+				t.Fatalf("InitClient() = %v, want valid = %v", err, tt.valid)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := c.Peers(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package p2p
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-resty/resty/v2"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// fromHeader is not authenticated
+const fromHeader = "X-Peer-Address"
+
+// every route of HTTPTransport is a POST endpoint
+type HTTPTransport struct {
+	address string
+	r       *gin.Engine
+	server  *http.Server
+	resty   *resty.Client
+	tls     *tls.Config
+	senders Senders
+	// unregistered are the routes a sender can request before its record is registered
+	unregistered map[string]bool
+}
+
+func NewHTTPTransport(address string) *HTTPTransport {
+	gin.SetMode(gin.ReleaseMode)
+	restyClient := resty.
+		New().
+		SetRetryCount(5).
+		SetRetryWaitTime(2 * time.Second).
+		AddRetryCondition(func(response *resty.Response, err error) bool {
+			return response.StatusCode() == http.StatusTooManyRequests ||
+				response.StatusCode() == http.StatusGatewayTimeout ||
+				response.StatusCode() == http.StatusServiceUnavailable ||
+				response.StatusCode() == http.StatusBadGateway ||
+				response.StatusCode() == http.StatusInternalServerError
+		})
+	return &HTTPTransport{
+		address: address,
+		r:       gin.New(),
+		resty:   restyClient,
+	}
+}
+
+func (t *HTTPTransport) Address() string {
+	return t.address
+}
+
+// Router can serve additional HTTP endpoints
+func (t *HTTPTransport) Router() *gin.Engine {
+	return t.r
+}
+
+// EnableTLS must be called before Start, the unregistered routes also accept a sender without a record
+func (t *HTTPTransport) EnableTLS(identity *Identity, nodeIDs NodeIDs, senders Senders, unregistered ...string) error {
+	cert, err := identity.Certificate()
+	if err != nil {
+		return err
+	}
+	transport, ok := t.resty.GetClient().Transport.(*http.Transport)
+	if !ok {
+		return errors.New("the transport of the HTTP client is not an http.Transport")
+	}
+	transport.DialTLSContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		// every connection verifies the certificate of the peer at the address
+		dialer := &tls.Dialer{
+			Config: clientTLSConfig(cert, address, nodeIDs),
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+	t.tls = serverTLSConfig(cert)
+	t.senders = senders
+	t.unregistered = make(map[string]bool)
+	for _, route := range unregistered {
+		t.unregistered[route] = true
+	}
+	return nil
+}
+
+// sender returns an empty address when the sender has no record and the route accepts it
+func (t *HTTPTransport) sender(state *tls.ConnectionState, route string) (string, string, error) {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return "", "", errors.New("the sender has no node certificate")
+	}
+	nodeID, err := CertificateNodeID(state.PeerCertificates[0])
+	if err != nil {
+		return "", "", err
+	}
+	address, ok := t.senders(nodeID)
+	if !ok && !t.unregistered[route] {
+		return "", "", fmt.Errorf("the certificate of %s is not bound to a registered peer record", nodeID)
+	}
+	return address, nodeID, nil
+}
+
+// serveHTTP does nothing when the transport is not an HTTP transport
+func serveHTTP(t Transport, path string, handler http.Handler) {
+	httpTransport, ok := t.(*HTTPTransport)
+	if !ok {
+		return
+	}
+	httpTransport.r.GET(path, gin.WrapH(handler))
+}
+
+func (t *HTTPTransport) Register(route string, handler Handler) {
+	handler = traceHandler(route, handler)
+	t.r.POST("/"+route, func(c *gin.Context) {
+		payload, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(400, nil)
+			return
+		}
+		// the span of the request continues on this peer
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		from := c.GetHeader(fromHeader)
+		if t.tls != nil {
+			var nodeID string
+			from, nodeID, err = t.sender(c.Request.TLS, route)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, map[string]interface{}{
+					"error": err.Error(),
+				})
+				return
+			}
+			ctx = withPeerNodeID(ctx, nodeID)
+		}
+		resp, err := handler(ctx, from, payload)
+		if err != nil {
+			c.JSON(400, map[string]interface{}{
+				"error": err.Error(),
+			})
+			return
+		}
+		c.Data(200, "application/json", resp)
+	})
+}
+
+func (t *HTTPTransport) Request(ctx context.Context, address string, route string, payload []byte) ([]byte, error) {
+	header := make(http.Header)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	resp, err := t.resty.R().
+		SetContext(ctx).
+		SetHeaderMultiValues(header).
+		SetHeader("Content-Type", "application/json").
+		SetHeader(fromHeader, t.address).
+		SetBody(payload).
+		Post(fmt.Sprintf("%s://%s/%s", t.scheme(), address, route))
+	if err != nil {
+		return nil, err
+	}
+	if resp.IsError() {
+		return nil, fmt.Errorf("unable to request %s, status: %d", route, resp.StatusCode())
+	}
+	return resp.Body(), nil
+}
+
+func (t *HTTPTransport) scheme() string {
+	if t.tls != nil {
+		return "https"
+	}
+	return "http"
+}
+
+func (t *HTTPTransport) Send(ctx context.Context, address string, route string, payload []byte) error {
+	go func() {
+		_, err := t.Request(ctx, address, route, payload)
+		if err != nil {
+			log.Debugf("unable to send %s to %s: %v", route, address, err)
+		}
+	}()
+	return nil
+}
+
+func (t *HTTPTransport) Start() error {
+	listener, err := net.Listen("tcp", t.address)
+	if err != nil {
+		return errors.Wrap(err, fmt.Sprintf("unable to listen on %s", t.address))
+	}
+	if t.tls != nil {
+		listener = tls.NewListener(listener, t.tls)
+	}
+	t.server = &http.Server{
+		Handler: t.r,
+	}
+	go func() {
+		err := t.server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	return nil
+}
+
+func (t *HTTPTransport) Close() error {
+	if t.server == nil {
+		return nil
+	}
+	return t.server.Close()
+}
@@ -0,0 +1,155 @@
+package p2p
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+const nodeIDPrefix = "NodeID-"
+
+// Identity is the ed25519 keypair of a node
+type Identity struct {
+	privateKey ed25519.PrivateKey
+}
+
+func NewIdentity() (*Identity, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to generate the keypair")
+	}
+	return &Identity{
+		privateKey: privateKey,
+	}, nil
+}
+
+// LoadIdentity writes a new seed to the file when it does not exist
+func LoadIdentity(path string) (*Identity, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, errors.Wrap(err, "unable to generate the keypair")
+		}
+		err = os.WriteFile(path, []byte(hex.EncodeToString(seed)), 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to write the key file")
+		}
+		return &Identity{
+			privateKey: ed25519.NewKeyFromSeed(seed),
+		}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the key file")
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("the key file %s is not a hex encoded ed25519 seed", path)
+	}
+	return &Identity{
+		privateKey: ed25519.NewKeyFromSeed(seed),
+	}, nil
+}
+
+func (i *Identity) PublicKey() ed25519.PublicKey {
+	return i.privateKey.Public().(ed25519.PublicKey)
+}
+
+func (i *Identity) NodeID() string {
+	return NodeID(i.PublicKey())
+}
+
+func (i *Identity) Sign(message []byte) []byte {
+	return ed25519.Sign(i.privateKey, message)
+}
+
+// NodeID is the hex encoded first 20 bytes of the sha256 hash of the public key
+func NodeID(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return nodeIDPrefix + hex.EncodeToString(sum[:20])
+}
+
+func verifySignature(publicKey, message, signature []byte) bool {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return false
+	}
+	return ed25519.Verify(publicKey, message, signature)
+}
+
+type SignedResponse struct {
+	Payload   []byte `json:"payload"`
+	Signature []byte `json:"signature"`
+	// the key of a peer is in its record, PublicKey is the key of the discovery
+	PublicKey []byte `json:"publicKey,omitempty"`
+}
+
+// responseMessage prefixes every field by its length in big endian
+func responseMessage(route string, from string, request []byte, response []byte) []byte {
+	var buf bytes.Buffer
+	for _, field := range [][]byte{[]byte(route), []byte(from), request, response} {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	return buf.Bytes()
+}
+
+type signedTransport struct {
+	Transport
+	identity *Identity
+}
+
+func newSignedTransport(t Transport, identity *Identity) *signedTransport {
+	return &signedTransport{
+		Transport: t,
+		identity:  identity,
+	}
+}
+
+func (t *signedTransport) Register(route string, handler Handler) {
+	t.Transport.Register(route, func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		resp, err := handler(ctx, from, payload)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(SignedResponse{
+			Payload:   resp,
+			Signature: t.identity.Sign(responseMessage(route, from, payload, resp)),
+		})
+	})
+}
+
+// discoveryTransport does not sign the sender, a node has no registered address before it registers over TLS
+type discoveryTransport struct {
+	Transport
+	identity *Identity
+}
+
+func newDiscoveryTransport(t Transport, identity *Identity) *discoveryTransport {
+	return &discoveryTransport{
+		Transport: t,
+		identity:  identity,
+	}
+}
+
+func (t *discoveryTransport) Register(route string, handler Handler) {
+	t.Transport.Register(route, func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		resp, err := handler(ctx, from, payload)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(SignedResponse{
+			Payload:   resp,
+			Signature: t.identity.Sign(responseMessage(route, "", payload, resp)),
+			PublicKey: t.identity.PublicKey(),
+		})
+	})
+}
@@ -0,0 +1,171 @@
+package p2p
+
+import (
+	"context"
+	"fmt"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"sync"
+)
+
+// MemoryNetwork connects in-process transports by their address, no socket is opened
+type MemoryNetwork struct {
+	mu         sync.RWMutex
+	transports map[string]*MemoryTransport
+}
+
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		transports: make(map[string]*MemoryTransport),
+	}
+}
+
+func (n *MemoryNetwork) NewTransport(address string) *MemoryTransport {
+	return &MemoryTransport{
+		network:  n,
+		address:  address,
+		handlers: make(map[string]Handler),
+		inbox:    make(chan *memoryMessage, 1024),
+		done:     make(chan struct{}),
+	}
+}
+
+func (n *MemoryNetwork) transport(address string) (*MemoryTransport, bool) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	t, ok := n.transports[address]
+	return t, ok
+}
+
+type memoryMessage struct {
+	ctx     context.Context
+	from    string
+	route   string
+	payload []byte
+	// reply receives the response of the handler, it is buffered so the handler never blocks
+	reply    chan memoryReply
+	receiver *MemoryTransport
+}
+
+type memoryReply struct {
+	payload []byte
+	err     error
+}
+
+type MemoryTransport struct {
+	network  *MemoryNetwork
+	address  string
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	inbox    chan *memoryMessage
+	done     chan struct{}
+	once     sync.Once
+}
+
+func (t *MemoryTransport) Address() string {
+	return t.address
+}
+
+func (t *MemoryTransport) Register(route string, handler Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.handlers[route] = traceHandler(route, handler)
+}
+
+func (t *MemoryTransport) Request(ctx context.Context, address string, route string, payload []byte) ([]byte, error) {
+	msg, err := t.deliver(ctx, address, route, payload)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case reply := <-msg.reply:
+		return reply.payload, reply.err
+	case <-msg.receiver.done:
+		// the receiver stopped before it handled the message
+		return nil, fmt.Errorf("the address %s is unreachable", address)
+	}
+}
+
+func (t *MemoryTransport) Send(ctx context.Context, address string, route string, payload []byte) error {
+	_, err := t.deliver(ctx, address, route, payload)
+	return err
+}
+
+func (t *MemoryTransport) deliver(ctx context.Context, address string, route string, payload []byte) (*memoryMessage, error) {
+	receiver, ok := t.network.transport(address)
+	if !ok {
+		return nil, fmt.Errorf("the address %s is unreachable", address)
+	}
+	msg := &memoryMessage{
+		ctx:      ctx,
+		from:     t.address,
+		route:    route,
+		payload:  payload,
+		reply:    make(chan memoryReply, 1),
+		receiver: receiver,
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-receiver.done:
+		return nil, fmt.Errorf("the address %s is unreachable", address)
+	case receiver.inbox <- msg:
+		return msg, nil
+	}
+}
+
+func (t *MemoryTransport) Start() error {
+	t.network.mu.Lock()
+	defer t.network.mu.Unlock()
+	if _, ok := t.network.transports[t.address]; ok {
+		return fmt.Errorf("the address %s is already in use", t.address)
+	}
+	t.network.transports[t.address] = t
+	go t.serve()
+	return nil
+}
+
+// serve handles every message of the inbox in its own goroutine, so handlers can send requests themselves
+func (t *MemoryTransport) serve() {
+	for {
+		select {
+		case <-t.done:
+			return
+		case msg := <-t.inbox:
+			go t.handle(msg)
+		}
+	}
+}
+
+func (t *MemoryTransport) handle(msg *memoryMessage) {
+	t.mu.RLock()
+	handler, ok := t.handlers[msg.route]
+	t.mu.RUnlock()
+	if !ok {
+		msg.reply <- memoryReply{
+			err: fmt.Errorf("the route %s is not found", msg.route),
+		}
+		return
+	}
+	payload, err := handler(msg.ctx, msg.from, msg.payload)
+	if err != nil {
+		log.Tracef("unable to handle %s from %s: %v", msg.route, msg.from, err)
+	}
+	msg.reply <- memoryReply{
+		payload: payload,
+		err:     err,
+	}
+}
+
+func (t *MemoryTransport) Close() error {
+	t.once.Do(func() {
+		t.network.mu.Lock()
+		defer t.network.mu.Unlock()
+		if t.network.transports[t.address] == t {
+			delete(t.network.transports, t.address)
+		}
+		close(t.done)
+	})
+	return nil
+}
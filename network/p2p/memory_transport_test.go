@@ -0,0 +1,230 @@
+package p2p_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+func startTransport(t *testing.T, network *p2p.MemoryNetwork, address string) *p2p.MemoryTransport {
+	t.Helper()
+	transport := network.NewTransport(address)
+	if err := transport.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = transport.Close()
+	})
+	return transport
+}
+
+func TestMemoryTransportRequest(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	a := network.NewTransport("a")
+	a.Register("echo", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		return []byte(from + ":" + string(payload)), nil
+	})
+	a.Register("fail", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		return nil, errors.New("the handler failed")
+	})
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+	b := startTransport(t, network, "b")
+
+	resp, err := b.Request(context.Background(), "a", "echo", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "b:hello" {
+		t.Errorf("response = %q, want %q", resp, "b:hello")
+	}
+	_, err = b.Request(context.Background(), "a", "fail", nil)
+	if err == nil || err.Error() != "the handler failed" {
+		t.Errorf("err = %v, want the error of the handler", err)
+	}
+}
+
+func TestMemoryTransportSend(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	received := make(chan string, 1)
+	a := network.NewTransport("a")
+	a.Register("push", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		received <- string(payload)
+		return nil, nil
+	})
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+	b := startTransport(t, network, "b")
+
+	if err := b.Send(context.Background(), "a", "push", []byte("block")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case payload := <-received:
+		if payload != "block" {
+			t.Errorf("payload = %q, want %q", payload, "block")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the message was not delivered")
+	}
+}
+
+func TestMemoryTransportErrors(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	startTransport(t, network, "a")
+	b := startTransport(t, network, "b")
+	closed := startTransport(t, network, "closed")
+	_ = closed.Close()
+
+	tests := []struct {
+		name    string
+		address string
+		route   string
+		err     string
+	}{
+		{name: "unknown route", address: "a", route: "unknown", err: "the route unknown is not found"},
+		{name: "unregistered peer", address: "nobody", route: "echo", err: "the address nobody is unreachable"},
+		{name: "closed peer", address: "closed", route: "echo", err: "the address closed is unreachable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := b.Request(context.Background(), tt.address, tt.route, nil)
+			if err == nil || err.Error() != tt.err {
+				t.Errorf("Request: err = %v, want %q", err, tt.err)
+			}
+		})
+	}
+	if err := b.Send(context.Background(), "nobody", "echo", nil); err == nil {
+		t.Error("Send to an unregistered peer succeeded")
+	}
+	if err := network.NewTransport("a").Start(); err == nil || !strings.Contains(err.Error(), "already in use") {
+		t.Errorf("Start: err = %v, want the address to be in use", err)
+	}
+}
+
+func TestMemoryTransportContextCancellation(t *testing.T) {
+	network := p2p.NewMemoryNetwork()
+	release := make(chan struct{})
+	defer close(release)
+	a := network.NewTransport("a")
+	a.Register("block", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		<-release
+		return nil, nil
+	})
+	if err := a.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = a.Close()
+	})
+	b := startTransport(t, network, "b")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := b.Request(ctx, "a", "block", nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the deadline to be exceeded", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = b.Request(cancelled, "a", "block", nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want the context to be canceled", err)
+	}
+}
+
+// runChains syncs the nodes one after another, so the answers they get only depend on the seed
+func runChains(t *testing.T, seed int64) [][]string {
+	t.Helper()
+	const (
+		numOfNodes  = 8
+		numOfBlocks = 10
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	network := p2p.NewMemoryNetwork()
+	discovery := p2p.InitDiscovery(network.NewTransport("discovery"))
+	if err := discovery.Start(); err != nil {
+		t.Fatal(err)
+	}
+	chains := make([]*chain.BlockChain, numOfNodes)
+	for j := range chains {
+		c, err := chain.InitBlockChain(ctx, chain.Config{
+			P2PConfig: p2p.Config{
+				DiscoveryAddress: discovery.Address,
+				Transport:        network.NewTransport(fmt.Sprintf("node-%d", j)),
+			},
+			ConsensusParameters: consensus.Parameters{
+				K:                   5,
+				Alpha:               4,
+				BetaVirtuous:        3,
+				BetaRogue:           5,
+				ConcurrentRepolls:   1,
+				MaxOutstandingItems: 64,
+			},
+			Concurrency: 4,
+			Seed:        seed + int64(j),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = c.Client().Close()
+		})
+		r := rand.New(rand.NewSource(seed + int64(j)))
+		for i := 0; i < numOfBlocks; i++ {
+			// most nodes start with the same data, the others with one of three other values
+			value := byte('a')
+			if r.Intn(5) == 0 {
+				value = byte('b' + r.Intn(3))
+			}
+			if err := c.Add(chain.NewBlock(c.LastBlock(), []byte{value, byte(i)}, 0)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		chains[j] = c
+	}
+
+	decided := make([][]string, numOfNodes)
+	for j, c := range chains {
+		if err := c.Sync(ctx); err != nil {
+			t.Fatalf("node %d: %v", j, err)
+		}
+		for _, block := range c.Blocks {
+			decided[j] = append(decided[j], block.BlockHash)
+		}
+	}
+	return decided
+}
+
+func TestMemoryNetworkRunsAreDeterministic(t *testing.T) {
+	first := runChains(t, 7)
+	second := runChains(t, 7)
+	for j := range first {
+		if len(first[j]) != len(second[j]) {
+			t.Fatalf("node %d: %d blocks in the first run, %d in the second", j, len(first[j]), len(second[j]))
+		}
+		for i := range first[j] {
+			if first[j][i] != second[j][i] {
+				t.Fatalf("node %d: the block %d differs between the runs with the same seed", j, i)
+			}
+		}
+	}
+}
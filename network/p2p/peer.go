@@ -1,6 +1,56 @@
 package p2p
 
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"time"
+)
+
 type Peer struct {
 	Address string `json:"address"`
 	ID      string `json:"id"`
+	// a peer without Weight is never sampled
+	Weight    uint64 `json:"weight"`
+	PublicKey []byte `json:"publicKey"`
+	// the record with the highest Seq replaces the others
+	Seq       uint64 `json:"seq"`
+	Signature []byte `json:"signature"`
+}
+
+func newPeer(address string, weight uint64, identity *Identity) *Peer {
+	p := &Peer{
+		Address:   address,
+		ID:        identity.NodeID(),
+		Weight:    weight,
+		PublicKey: identity.PublicKey(),
+		Seq:       uint64(time.Now().UnixNano()),
+	}
+	p.Signature = identity.Sign(p.message())
+	return p
+}
+
+// message prefixes the variable length fields by their length in big endian
+func (p *Peer) message() []byte {
+	var buf bytes.Buffer
+	for _, field := range [][]byte{[]byte(p.Address), []byte(p.ID)} {
+		_ = binary.Write(&buf, binary.BigEndian, uint32(len(field)))
+		buf.Write(field)
+	}
+	_ = binary.Write(&buf, binary.BigEndian, p.Weight)
+	_ = binary.Write(&buf, binary.BigEndian, uint32(len(p.PublicKey)))
+	buf.Write(p.PublicKey)
+	_ = binary.Write(&buf, binary.BigEndian, p.Seq)
+	return buf.Bytes()
+}
+
+func (p *Peer) Verify() error {
+	if id := NodeID(p.PublicKey); p.ID != id {
+		return fmt.Errorf("the ID %s of the peer is not the NodeID %s of its public key", p.ID, id)
+	}
+	if !verifySignature(p.PublicKey, p.message(), p.Signature) {
+		return errors.New("the record of the peer is not signed with its key")
+	}
+	return nil
 }
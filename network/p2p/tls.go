@@ -0,0 +1,118 @@
+package p2p
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"github.com/pkg/errors"
+	"math/big"
+	"time"
+)
+
+type NodeIDs func(address string) (string, bool)
+
+type Senders func(nodeID string) (string, bool)
+
+// Certificate is self-signed
+func (i *Identity) Certificate() (tls.Certificate, error) {
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "unable to generate the serial number")
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: i.NodeID()},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(100, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, i.PublicKey(), i.privateKey)
+	if err != nil {
+		return tls.Certificate{}, errors.Wrap(err, "unable to create the certificate")
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der},
+		PrivateKey:  i.privateKey,
+	}, nil
+}
+
+// CertificateNodeID requires the certificate to be signed with its ed25519 key
+func CertificateNodeID(cert *x509.Certificate) (string, error) {
+	publicKey, ok := cert.PublicKey.(ed25519.PublicKey)
+	if !ok {
+		return "", errors.New("the key of the certificate is not an ed25519 key")
+	}
+	err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+	if err != nil {
+		return "", errors.Wrap(err, "the certificate is not signed with its key")
+	}
+	return NodeID(publicKey), nil
+}
+
+func certificatesNodeID(rawCerts [][]byte) (string, error) {
+	if len(rawCerts) == 0 {
+		return "", errors.New("the peer has no certificate")
+	}
+	cert, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return "", errors.Wrap(err, "unable to parse the certificate of the peer")
+	}
+	return CertificateNodeID(cert)
+}
+
+// serverTLSConfig lets a sender without a certificate reach the HTTP endpoints that are not routes, as the metrics
+func serverTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequestClientCert,
+		MinVersion:   tls.VersionTLS13,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return nil
+			}
+			_, err := certificatesNodeID(rawCerts)
+			return err
+		},
+	}
+}
+
+// clientTLSConfig has no CA, the certificate is trusted when its NodeID is the one the address is known with
+func clientTLSConfig(cert tls.Certificate, address string, nodeIDs NodeIDs) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS13,
+		// the chain is verified below instead, against the NodeID of the peer
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			nodeID, err := certificatesNodeID(rawCerts)
+			if err != nil {
+				return err
+			}
+			expected, ok := nodeIDs(address)
+			if !ok {
+				return fmt.Errorf("the peer %s has no registered record to verify its certificate with", address)
+			}
+			if nodeID != expected {
+				return fmt.Errorf("the peer %s presents the certificate of %s instead of %s", address, nodeID, expected)
+			}
+			return nil
+		},
+	}
+}
+
+type nodeIDKey struct{}
+
+func withPeerNodeID(ctx context.Context, nodeID string) context.Context {
+	return context.WithValue(ctx, nodeIDKey{}, nodeID)
+}
+
+func PeerNodeID(ctx context.Context) (string, bool) {
+	nodeID, ok := ctx.Value(nodeIDKey{}).(string)
+	return nodeID, ok
+}
@@ -0,0 +1,167 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/phayes/freeport"
+)
+
+type whoami struct{}
+
+func (whoami) Router(t Transport) {
+	t.Register("whoami", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		return json.Marshal(from)
+	})
+}
+
+func freeAddress(t *testing.T) (string, int) {
+	t.Helper()
+	port, err := freeport.GetFreePort()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("127.0.0.1:%d", port), port
+}
+
+func newTestIdentity(t *testing.T) *Identity {
+	t.Helper()
+	identity, err := NewIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identity
+}
+
+func startTLSDiscovery(t *testing.T) (*Discovery, string) {
+	t.Helper()
+	address, _ := freeAddress(t)
+	transport := NewHTTPTransport(address)
+	discovery := InitDiscovery(transport)
+	identity := newTestIdentity(t)
+	discovery.SetIdentity(identity)
+	if err := transport.EnableTLS(identity, discovery.NodeID, discovery.PeerAddress, "register-peer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := discovery.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = transport.Close()
+	})
+	return discovery, identity.NodeID()
+}
+
+func startTLSClient(t *testing.T, discovery *Discovery, discoveryNodeID string, identity *Identity) (*Client, error) {
+	t.Helper()
+	_, port := freeAddress(t)
+	c, err := InitClient(context.Background(), Config{
+		Host:             "127.0.0.1",
+		Port:             port,
+		DiscoveryAddress: discovery.Address,
+		DiscoveryNodeID:  discoveryNodeID,
+		Identity:         identity,
+		TLS:              true,
+	}, func(int) ([]byte, error) {
+		return []byte("a"), nil
+	}, whoami{})
+	if err != nil {
+		return nil, err
+	}
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c, nil
+}
+
+// rogueTransport trusts the certificate of the peer
+func rogueTransport(t *testing.T, identity *Identity, peer *Peer) *HTTPTransport {
+	t.Helper()
+	address, _ := freeAddress(t)
+	transport := NewHTTPTransport(address)
+	nodeIDs := func(address string) (string, bool) {
+		return peer.ID, address == peer.Address
+	}
+	senders := func(string) (string, bool) {
+		return "", false
+	}
+	if err := transport.EnableTLS(identity, nodeIDs, senders); err != nil {
+		t.Fatal(err)
+	}
+	return transport
+}
+
+func TestTLSSenders(t *testing.T) {
+	discovery, discoveryNodeID := startTLSDiscovery(t)
+	aIdentity := newTestIdentity(t)
+	a, err := startTLSClient(t, discovery, discoveryNodeID, aIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := startTLSClient(t, discovery, discoveryNodeID, newTestIdentity(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var from string
+	if err := a.Request(context.Background(), b.Peer(), "whoami", nil, &from); err != nil {
+		t.Fatal(err)
+	}
+	if from != a.Peer().Address {
+		t.Errorf("the request is from %s, want %s", from, a.Peer().Address)
+	}
+
+	t.Run("the sender is the peer of the certificate, not the header", func(t *testing.T) {
+		// the transport of the registered identity sends another address in the header
+		transport := rogueTransport(t, aIdentity, b.Peer())
+		resp, err := transport.Request(context.Background(), b.Peer().Address, "whoami", []byte("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var signed SignedResponse
+		if err := json.Unmarshal(resp, &signed); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(signed.Payload, &from); err != nil {
+			t.Fatal(err)
+		}
+		if from != a.Peer().Address {
+			t.Errorf("the request is from %s, want %s", from, a.Peer().Address)
+		}
+	})
+
+	t.Run("a certificate without a registered record is rejected", func(t *testing.T) {
+		transport := rogueTransport(t, newTestIdentity(t), b.Peer())
+		_, err := transport.Request(context.Background(), b.Peer().Address, "whoami", []byte("{}"))
+		if err == nil || !strings.Contains(err.Error(), "401") {
+			t.Errorf("err = %v, want the request to be unauthorized", err)
+		}
+	})
+
+	t.Run("an address without a registered record is refused", func(t *testing.T) {
+		transport := rogueTransport(t, newTestIdentity(t), b.Peer())
+		if err := transport.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer transport.Close()
+		_, err := a.Transport().Request(context.Background(), transport.Address(), "whoami", []byte("{}"))
+		if err == nil || !strings.Contains(err.Error(), "no registered record") {
+			t.Errorf("err = %v, want the address to be refused", err)
+		}
+	})
+}
+
+func TestTLSPinsTheDiscovery(t *testing.T) {
+	discovery, _ := startTLSDiscovery(t)
+	_, err := startTLSClient(t, discovery, newTestIdentity(t).NodeID(), newTestIdentity(t))
+	if err == nil || !strings.Contains(err.Error(), "instead of") {
+		t.Errorf("err = %v, want the certificate of the discovery to be refused", err)
+	}
+	_, err = startTLSClient(t, discovery, "", newTestIdentity(t))
+	if err == nil {
+		t.Error("a client without the NodeID of the discovery started over TLS")
+	}
+}
@@ -0,0 +1,74 @@
+package p2p
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTransportsPropagateTheSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracerProvider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(tracerProvider)
+		otel.SetTextMapPropagator(propagator)
+		_ = provider.Shutdown(context.Background())
+	})
+
+	tests := []struct {
+		name       string
+		transports func(t *testing.T) (Transport, Transport)
+	}{
+		{name: "memory", transports: func(t *testing.T) (Transport, Transport) {
+			network := NewMemoryNetwork()
+			return network.NewTransport("node-0"), network.NewTransport("node-1")
+		}},
+		{name: "http", transports: func(t *testing.T) (Transport, Transport) {
+			from, _ := freeAddress(t)
+			to, _ := freeAddress(t)
+			return NewHTTPTransport(from), NewHTTPTransport(to)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter.Reset()
+			from, to := tt.transports(t)
+			whoami{}.Router(to)
+			for _, transport := range []Transport{from, to} {
+				if err := transport.Start(); err != nil {
+					t.Fatal(err)
+				}
+				transport := transport
+				t.Cleanup(func() {
+					_ = transport.Close()
+				})
+			}
+			ctx, span := provider.Tracer("test").Start(context.Background(), "poll")
+			if _, err := from.Request(ctx, to.Address(), "whoami", []byte("{}")); err != nil {
+				t.Fatal(err)
+			}
+			span.End()
+
+			spans := exporter.GetSpans()
+			var handled *tracetest.SpanStub
+			for i := range spans {
+				if spans[i].Name == "whoami" {
+					handled = &spans[i]
+				}
+			}
+			if handled == nil {
+				t.Fatalf("the peer did not trace the request, spans: %d", len(spans))
+			}
+			if handled.SpanContext.TraceID() != span.SpanContext().TraceID() || handled.Parent.SpanID() != span.SpanContext().SpanID() {
+				t.Error("the span of the peer does not continue the span of the request")
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package p2p
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Handler must not trust from without TLS, it is only the address the sender claims
+type Handler func(ctx context.Context, from string, payload []byte) ([]byte, error)
+
+// Transport delivers requests between peers
+type Transport interface {
+	Address() string
+	// Register must be called before Start
+	Register(route string, handler Handler)
+	Request(ctx context.Context, address string, route string, payload []byte) ([]byte, error)
+	Send(ctx context.Context, address string, route string, payload []byte) error
+	Start() error
+	Close() error
+}
+
+type Router interface {
+	Router(t Transport)
+}
+
+// traceHandler does not trace the requests sent outside a span
+func traceHandler(route string, handler Handler) Handler {
+	return func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		if !trace.SpanContextFromContext(ctx).IsValid() {
+			return handler(ctx, from, payload)
+		}
+		ctx, span := tracer.Start(ctx, route, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+			attribute.String("peer.address", from),
+		))
+		defer span.End()
+		resp, err := handler(ctx, from, payload)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "the handler failed")
+		}
+		return resp, err
+	}
+}
+
+func request(ctx context.Context, t Transport, address string, route string, req interface{}, resp interface{}) error {
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return errors.Wrap(err, "unable to encode the request")
+	}
+	respPayload, err := t.Request(ctx, address, route, payload)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(respPayload, resp)
+}
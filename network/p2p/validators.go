@@ -0,0 +1,20 @@
+package p2p
+
+import "fmt"
+
+// Validators give the stake 1 to every node when the set is nil
+type Validators map[string]uint64
+
+func (v Validators) Weight(nodeID string) uint64 {
+	if v == nil {
+		return 1
+	}
+	return v[nodeID]
+}
+
+func (v Validators) Verify(peer *Peer) error {
+	if weight := v.Weight(peer.ID); peer.Weight != weight {
+		return fmt.Errorf("weight = %d, stake = %d: fails the condition that: the peer %s registers the stake of its NodeID", peer.Weight, weight, peer.ID)
+	}
+	return nil
+}
@@ -4,21 +4,49 @@ import (
 	"context"
 	"github.com/pkg/errors"
 	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
-	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
 	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/avalanche"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/bootstrap"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/snowman"
 )
 
 type Node struct {
 	*chain.BlockChain
+	Avalanche    *avalanche.Engine
+	Snowman      *snowman.Engine
+	Bootstrapper *bootstrap.Bootstrapper
 }
 
-func InitNode(ctx context.Context, config chain.Config, discovery *p2p.Discovery) (*Node, error) {
+func InitNode(ctx context.Context, config chain.Config) (*Node, error) {
 	s := &Node{}
-	blockchain, err := chain.InitBlockChain(ctx, config, discovery)
+	engine, err := avalanche.NewEngine(config.ConsensusParameters, config.Seed)
+	if err != nil {
+		log.Error(err)
+		return nil, errors.Wrap(err, "unable to init avalanche engine")
+	}
+	s.Avalanche = engine
+	snowmanEngine, err := snowman.NewEngine(config.ConsensusParameters, config.Seed, config.Recorder)
+	if err != nil {
+		log.Error(err)
+		return nil, errors.Wrap(err, "unable to init snowman engine")
+	}
+	s.Snowman = snowmanEngine
+	bootstrapper, err := bootstrap.NewBootstrapper(config.ConsensusParameters, config.Seed)
+	if err != nil {
+		log.Error(err)
+		return nil, errors.Wrap(err, "unable to init bootstrapper")
+	}
+	s.Bootstrapper = bootstrapper
+	blockchain, err := chain.InitBlockChain(ctx, config, engine, snowmanEngine, bootstrapper)
 	if err != nil {
 		log.Error(err)
 		return nil, errors.Wrap(err, "unable to init blockchain")
 	}
 	s.BlockChain = blockchain
+	engine.SetClient(blockchain.Client())
+	snowmanEngine.SetClient(blockchain.Client())
+	snowmanEngine.SetChain(blockchain.BlockChainState)
+	bootstrapper.SetClient(blockchain.Client())
+	bootstrapper.SetChain(blockchain.BlockChainState)
 	return s, nil
 }
@@ -22,6 +22,10 @@ func Build() *logrus.Logger {
 }
 
 func newRlog() *rlog {
+	// the packages logging without main, as in their tests, get the default logger
+	if logger == nil {
+		Build()
+	}
 	return &rlog{
 		entry: logrus.NewEntry(logger),
 	}
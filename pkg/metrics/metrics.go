@@ -0,0 +1,195 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"net/http"
+	"time"
+)
+
+const namespace = "avalanche"
+
+// Node has its own registry so the nodes of a process are told apart, the methods do nothing when it is nil
+type Node struct {
+	registry         *prometheus.Registry
+	polls            prometheus.Counter
+	successfulPolls  prometheus.Counter
+	confidenceResets prometheus.Counter
+	finalizedBlocks  prometheus.Counter
+	queryLatency     *prometheus.HistogramVec
+	failedRequests   *prometheus.CounterVec
+	peers            prometheus.Gauge
+}
+
+func NewNode() *Node {
+	n := &Node{
+		registry: prometheus.NewRegistry(),
+		polls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "polls_total",
+			Help:      "Number of polls of k peers issued.",
+		}),
+		successfulPolls: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "successful_polls_total",
+			Help:      "Number of recorded polls in which a choice got an alpha majority.",
+		}),
+		confidenceResets: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "confidence_resets_total",
+			Help:      "Number of times the confidence of a decision was reset by an unsuccessful or conflicting poll.",
+		}),
+		finalizedBlocks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "finalized_blocks_total",
+			Help:      "Number of finalized blocks.",
+		}),
+		queryLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "query_latency_seconds",
+			Help:      "Latency of the successful requests to the peers.",
+			Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+		}, []string{"route"}),
+		failedRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "failed_peer_requests_total",
+			Help:      "Number of requests to the peers that failed.",
+		}, []string{"route"}),
+		peers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "peers",
+			Help:      "Number of peers returned by the discovery.",
+		}),
+	}
+	n.registry.MustRegister(n.polls, n.successfulPolls, n.confidenceResets, n.finalizedBlocks, n.queryLatency, n.failedRequests, n.peers)
+	return n
+}
+
+func (n *Node) Handler() http.Handler {
+	return promhttp.HandlerFor(n.registry, promhttp.HandlerOpts{})
+}
+
+func (n *Node) PollIssued() {
+	if n == nil {
+		return
+	}
+	n.polls.Inc()
+}
+
+// ObserveRequest records the latency of a request, or its failure
+func (n *Node) ObserveRequest(route string, latency time.Duration, err error) {
+	if n == nil {
+		return
+	}
+	if err != nil {
+		n.failedRequests.WithLabelValues(route).Inc()
+		return
+	}
+	n.queryLatency.WithLabelValues(route).Observe(latency.Seconds())
+}
+
+func (n *Node) SetPeers(peers int) {
+	if n == nil {
+		return
+	}
+	n.peers.Set(float64(peers))
+}
+
+// confident is implemented by the decisions counting the consecutive successful polls of their preference
+type confident interface {
+	Confidence() int
+}
+
+// Observe returns the consensus itself when the metrics are nil
+func (n *Node) Observe(c consensus.Consensus) consensus.Consensus {
+	if n == nil {
+		return c
+	}
+	return &observedConsensus{
+		Consensus: c,
+		metrics:   n,
+	}
+}
+
+type observedConsensus struct {
+	consensus.Consensus
+	metrics   *Node
+	finalized bool
+}
+
+func (o *observedConsensus) RecordPoll(preferences [][]byte) error {
+	wasFinalized := o.Consensus.Finalized()
+	confidence, hasConfidence := o.confidence()
+	err := o.Consensus.RecordPoll(preferences)
+	if err != nil {
+		return err
+	}
+	frequent, _, err := consensus.GetMostFrequentPreference(preferences)
+	if err == nil && frequent >= o.Parameters().Alpha {
+		o.metrics.successfulPolls.Inc()
+	}
+	// a successful poll for the preference is the only one increasing the confidence
+	if newConfidence, _ := o.confidence(); hasConfidence && !wasFinalized && confidence > 0 && newConfidence <= confidence {
+		o.metrics.confidenceResets.Inc()
+	}
+	o.Finalized()
+	return nil
+}
+
+// Finalized counts the finalization too
+func (o *observedConsensus) Finalized() bool {
+	finalized := o.Consensus.Finalized()
+	if finalized && !o.finalized {
+		o.finalized = true
+		o.metrics.finalizedBlocks.Inc()
+	}
+	return finalized
+}
+
+func (o *observedConsensus) confidence() (int, bool) {
+	c, ok := o.Consensus.(confident)
+	if !ok {
+		return 0, false
+	}
+	return c.Confidence(), true
+}
+
+type Discovery struct {
+	registry      *prometheus.Registry
+	peers         prometheus.Gauge
+	registrations prometheus.Counter
+}
+
+func NewDiscovery() *Discovery {
+	d := &Discovery{
+		registry: prometheus.NewRegistry(),
+		peers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "peers",
+			Help:      "Number of registered peers.",
+		}),
+		registrations: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "discovery",
+			Name:      "registrations_total",
+			Help:      "Number of registration requests of the peers.",
+		}),
+	}
+	d.registry.MustRegister(d.peers, d.registrations)
+	return d
+}
+
+func (d *Discovery) Handler() http.Handler {
+	return promhttp.HandlerFor(d.registry, promhttp.HandlerOpts{})
+}
+
+func (d *Discovery) Registered(peers int) {
+	d.registrations.Inc()
+	d.peers.Set(float64(peers))
+}
+
+func (d *Discovery) SetPeers(peers int) {
+	d.peers.Set(float64(peers))
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+// poll returns the votes of k = 5 peers, the first ones for the choice
+func poll(votes int, choice, other string) [][]byte {
+	preferences := make([][]byte, 0, 5)
+	for i := 0; i < 5; i++ {
+		if i < votes {
+			preferences = append(preferences, []byte(choice))
+		} else {
+			preferences = append(preferences, []byte(other))
+		}
+	}
+	return preferences
+}
+
+func TestNodeObserve(t *testing.T) {
+	tests := []struct {
+		name             string
+		polls            [][][]byte
+		successfulPolls  float64
+		confidenceResets float64
+		finalizedBlocks  float64
+	}{
+		{
+			name:            "successful polls finalize the block",
+			polls:           [][][]byte{poll(5, "a", "b"), poll(5, "a", "b")},
+			successfulPolls: 2,
+			finalizedBlocks: 1,
+		},
+		{
+			name:             "a poll without alpha-majority resets the confidence",
+			polls:            [][][]byte{poll(5, "a", "b"), append(poll(2, "a", "b")[:4], []byte("c"))},
+			successfulPolls:  1,
+			confidenceResets: 1,
+		},
+		{
+			name:             "a flip resets the confidence",
+			polls:            [][][]byte{poll(5, "a", "b"), poll(3, "b", "a"), poll(5, "b", "a"), poll(5, "b", "a")},
+			successfulPolls:  4,
+			confidenceResets: 1,
+			finalizedBlocks:  1,
+		},
+		{
+			name:            "the polls after the finalization are ignored",
+			polls:           [][][]byte{poll(5, "a", "b"), poll(5, "a", "b"), poll(5, "b", "a")},
+			successfulPolls: 3,
+			finalizedBlocks: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := NewNode()
+			c, err := consensus.NewConsensus(consensus.Parameters{
+				Algorithm:           consensus.SnowflakeAlgorithm,
+				K:                   5,
+				Alpha:               3,
+				BetaVirtuous:        2,
+				BetaRogue:           3,
+				ConcurrentRepolls:   1,
+				MaxOutstandingItems: 1,
+			}, []byte("a"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c = n.Observe(c)
+			for _, preferences := range tt.polls {
+				n.PollIssued()
+				if err := c.RecordPoll(preferences); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, m := range []struct {
+				name      string
+				got, want float64
+			}{
+				{name: "polls", got: testutil.ToFloat64(n.polls), want: float64(len(tt.polls))},
+				{name: "successful polls", got: testutil.ToFloat64(n.successfulPolls), want: tt.successfulPolls},
+				{name: "confidence resets", got: testutil.ToFloat64(n.confidenceResets), want: tt.confidenceResets},
+				{name: "finalized blocks", got: testutil.ToFloat64(n.finalizedBlocks), want: tt.finalizedBlocks},
+			} {
+				if m.got != m.want {
+					t.Errorf("%s = %v, want %v", m.name, m.got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNodeHandler(t *testing.T) {
+	n := NewNode()
+	n.PollIssued()
+	n.SetPeers(3)
+	rec := httptest.NewRecorder()
+	n.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"avalanche_polls_total 1", "avalanche_peers 3"} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("the metrics do not contain %q", line)
+		}
+	}
+}
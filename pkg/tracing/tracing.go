@@ -0,0 +1,113 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"net/http"
+	"os"
+	"sync"
+)
+
+const (
+	FileExporter = "file"
+	// MemoryExporter serves the spans as JSON on GET /traces of the HTTP routers
+	MemoryExporter = "memory"
+)
+
+type Config struct {
+	// an empty Exporter disables the tracing
+	Exporter string `json:"exporter" yaml:"exporter" toml:"exporter"`
+	File     string `json:"file" yaml:"file" toml:"file"`
+	// the spans of a sampled request are sampled on the peer too
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio" toml:"sample_ratio"`
+}
+
+func (c *Config) Verify() error {
+	switch c.Exporter {
+	case "", MemoryExporter:
+	case FileExporter:
+		if c.File == "" {
+			return fmt.Errorf("the file of the %s exporter is empty", FileExporter)
+		}
+	default:
+		return fmt.Errorf("the tracing exporter %s is unknown", c.Exporter)
+	}
+	if c.SampleRatio < 0 || c.SampleRatio > 1 {
+		return fmt.Errorf("sampleRatio = %v: fails the condition that: 0 <= sampleRatio <= 1", c.SampleRatio)
+	}
+	return nil
+}
+
+var (
+	mu sync.Mutex
+	// memory is nil when another exporter is used
+	memory *tracetest.InMemoryExporter
+)
+
+// Start installs the tracer provider for the whole process, the returned function flushes the spans
+func Start(cfg Config, serviceName string) (func(context.Context) error, error) {
+	if cfg.Exporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	switch cfg.Exporter {
+	case FileExporter:
+		var err error
+		file, err = os.Create(cfg.File)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create the file of the traces")
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to create the exporter of the traces")
+		}
+	case MemoryExporter:
+		mu.Lock()
+		memory = tracetest.NewInMemoryExporter()
+		exporter = memory
+		mu.Unlock()
+	default:
+		return nil, fmt.Errorf("the tracing exporter %s is unknown", cfg.Exporter)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			closeErr := file.Close()
+			if err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		exporter := memory
+		mu.Unlock()
+		if exporter == nil {
+			http.Error(w, fmt.Sprintf("the spans are only kept with the %s exporter", MemoryExporter), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(exporter.GetSpans())
+	})
+}
@@ -0,0 +1,140 @@
+package report
+
+import (
+	"bytes"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"sync"
+	"time"
+)
+
+type blockStats struct {
+	// rounds are the recorded polls, queries are the answers of the recorded polls
+	rounds  int
+	queries int
+	flips   int
+	start   time.Duration
+	// finality is only set once the block is finalized
+	finality   time.Duration
+	finalized  bool
+	preference []byte
+}
+
+// Recorder is safe for concurrent use
+type Recorder struct {
+	mu          sync.Mutex
+	now         func() time.Duration
+	numOfBlocks int
+	nodes       map[int][]*blockStats
+}
+
+// NewRecorder reads the current time of the run with now
+func NewRecorder(numOfBlocks int, now func() time.Duration) *Recorder {
+	return &Recorder{
+		now:         now,
+		numOfBlocks: numOfBlocks,
+		nodes:       make(map[int][]*blockStats),
+	}
+}
+
+func NewWallClockRecorder(numOfBlocks int) *Recorder {
+	start := time.Now()
+	return NewRecorder(numOfBlocks, func() time.Duration {
+		return time.Since(start)
+	})
+}
+
+// Node counts the node in the report even if it never decides a block
+func (r *Recorder) Node(node int) *NodeRecorder {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.nodes[node]; !ok {
+		r.nodes[node] = make([]*blockStats, r.numOfBlocks)
+	}
+	return &NodeRecorder{
+		recorder: r,
+		node:     node,
+	}
+}
+
+type NodeRecorder struct {
+	recorder *Recorder
+	node     int
+}
+
+// Observe returns the consensus itself when the recorder is nil
+func (n *NodeRecorder) Observe(index int, c consensus.Consensus) consensus.Consensus {
+	if n == nil {
+		return c
+	}
+	r := n.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blocks := r.nodes[n.node]
+	if index < 0 || index >= len(blocks) {
+		return c
+	}
+	// a block decided again after a restart keeps the statistics of its first decision
+	stats := blocks[index]
+	if stats == nil {
+		stats = &blockStats{
+			start:      r.now(),
+			preference: c.Preference(),
+		}
+		blocks[index] = stats
+	}
+	return &observedConsensus{
+		Consensus: c,
+		recorder:  r,
+		stats:     stats,
+	}
+}
+
+type observedConsensus struct {
+	consensus.Consensus
+	recorder *Recorder
+	stats    *blockStats
+}
+
+func (o *observedConsensus) RecordPoll(preferences [][]byte) error {
+	err := o.Consensus.RecordPoll(preferences)
+	if err != nil {
+		return err
+	}
+	// the parent of a Snowman block is observed too, so it is checked before taking the lock
+	finalized := o.Consensus.Finalized()
+	preference := o.Consensus.Preference()
+	r := o.recorder
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o.stats.rounds++
+	o.stats.queries += len(preferences)
+	if !bytes.Equal(preference, o.stats.preference) {
+		o.stats.flips++
+		o.stats.preference = preference
+	}
+	if finalized {
+		o.observeFinalized()
+	}
+	return nil
+}
+
+// Finalized records the finalization too, Snowman finalizes a block with its parent without polling it
+func (o *observedConsensus) Finalized() bool {
+	finalized := o.Consensus.Finalized()
+	if finalized {
+		r := o.recorder
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		o.observeFinalized()
+	}
+	return finalized
+}
+
+// observeFinalized must be called with the lock held
+func (o *observedConsensus) observeFinalized() {
+	if o.stats.finalized {
+		return
+	}
+	o.stats.finalized = true
+	o.stats.finality = o.recorder.now() - o.stats.start
+}
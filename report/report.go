@@ -0,0 +1,197 @@
+package report
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+)
+
+type Distribution struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	Min   float64 `json:"min"`
+	P50   float64 `json:"p50"`
+	P90   float64 `json:"p90"`
+	P99   float64 `json:"p99"`
+	Max   float64 `json:"max"`
+}
+
+// NewDistribution uses the nearest rank percentiles
+func NewDistribution(values []float64) Distribution {
+	if len(values) == 0 {
+		return Distribution{}
+	}
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+	}
+	return Distribution{
+		Count: len(sorted),
+		Mean:  sum / float64(len(sorted)),
+		Min:   sorted[0],
+		P50:   Percentile(sorted, 50),
+		P90:   Percentile(sorted, 90),
+		P99:   Percentile(sorted, 99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+func Percentile(sorted []float64, percentile float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+type SafetyViolation struct {
+	Index int `json:"index"`
+	// the data is hex encoded
+	Nodes map[string][]int `json:"nodes"`
+}
+
+type Report struct {
+	Nodes     int     `json:"nodes"`
+	Blocks    int     `json:"blocks"`
+	Finalized float64 `json:"finalized"`
+	// Rounds and Queries are counted until a block was finalized
+	Rounds  Distribution `json:"rounds"`
+	Queries Distribution `json:"queries"`
+	// Finality is in seconds from the first poll of a block
+	Finality   Distribution `json:"finality_seconds"`
+	Flips      Distribution `json:"flips"`
+	TotalFlips int          `json:"total_flips"`
+	// Agreement is the mean over the blocks of the fraction of the nodes preferring the most common data
+	Agreement        float64           `json:"agreement"`
+	AgreedBlocks     int               `json:"agreed_blocks"`
+	SafetyViolations []SafetyViolation `json:"safety_violations"`
+}
+
+func (r *Recorder) Report() *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := &Report{
+		Nodes:            len(r.nodes),
+		Blocks:           r.numOfBlocks,
+		SafetyViolations: make([]SafetyViolation, 0),
+	}
+	nodes := make([]int, 0, len(r.nodes))
+	for node := range r.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Ints(nodes)
+
+	var rounds, queries, finality, flips []float64
+	finalized := 0
+	for _, node := range nodes {
+		for _, stats := range r.nodes[node] {
+			if stats == nil {
+				continue
+			}
+			report.TotalFlips += stats.flips
+			flips = append(flips, float64(stats.flips))
+			if !stats.finalized {
+				continue
+			}
+			finalized++
+			rounds = append(rounds, float64(stats.rounds))
+			queries = append(queries, float64(stats.queries))
+			finality = append(finality, stats.finality.Seconds())
+		}
+	}
+	if len(nodes) > 0 && r.numOfBlocks > 0 {
+		report.Finalized = float64(finalized) / float64(len(nodes)*r.numOfBlocks)
+	}
+	report.Rounds = NewDistribution(rounds)
+	report.Queries = NewDistribution(queries)
+	report.Finality = NewDistribution(finality)
+	report.Flips = NewDistribution(flips)
+
+	agreement := 0.0
+	for index := 0; index < r.numOfBlocks; index++ {
+		preferred := make(map[string]int)
+		finalizedBy := make(map[string][]int)
+		voters := 0
+		for _, node := range nodes {
+			stats := r.nodes[node][index]
+			if stats == nil {
+				continue
+			}
+			voters++
+			data := hex.EncodeToString(stats.preference)
+			preferred[data]++
+			if stats.finalized {
+				finalizedBy[data] = append(finalizedBy[data], node)
+			}
+		}
+		if voters == 0 {
+			continue
+		}
+		mostCommon := 0
+		for _, count := range preferred {
+			if count > mostCommon {
+				mostCommon = count
+			}
+		}
+		agreement += float64(mostCommon) / float64(voters)
+		if len(preferred) == 1 {
+			report.AgreedBlocks++
+		}
+		if len(finalizedBy) > 1 {
+			report.SafetyViolations = append(report.SafetyViolations, SafetyViolation{
+				Index: index,
+				Nodes: finalizedBy,
+			})
+		}
+	}
+	if r.numOfBlocks > 0 {
+		report.Agreement = agreement / float64(r.numOfBlocks)
+	}
+	return report
+}
+
+func (r *Report) WriteJSON(path string) error {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o644)
+}
+
+func (r *Report) Summary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "nodes: %d, blocks: %d, finalized: %.2f%%\n", r.Nodes, r.Blocks, r.Finalized*100)
+	fmt.Fprintf(&b, "rounds per block:     %s\n", r.Rounds)
+	fmt.Fprintf(&b, "queries per block:    %s\n", r.Queries)
+	fmt.Fprintf(&b, "time to finality (s): %s\n", r.Finality)
+	fmt.Fprintf(&b, "preference flips:     %s, total %d\n", r.Flips, r.TotalFlips)
+	fmt.Fprintf(&b, "agreement: %.2f%%, blocks every node agrees on: %d/%d\n", r.Agreement*100, r.AgreedBlocks, r.Blocks)
+	if len(r.SafetyViolations) == 0 {
+		b.WriteString("safety violations: none\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "safety violations: %d\n", len(r.SafetyViolations))
+	for _, violation := range r.SafetyViolations {
+		finalized := make([]string, 0, len(violation.Nodes))
+		for data, nodes := range violation.Nodes {
+			finalized = append(finalized, fmt.Sprintf("%s by %d nodes", data, len(nodes)))
+		}
+		sort.Strings(finalized)
+		fmt.Fprintf(&b, "  block %d finalized as %s\n", violation.Index, strings.Join(finalized, ", "))
+	}
+	return b.String()
+}
+
+func (d Distribution) String() string {
+	return fmt.Sprintf("mean %.3f, min %.3f, p50 %.3f, p90 %.3f, p99 %.3f, max %.3f", d.Mean, d.Min, d.P50, d.P90, d.P99, d.Max)
+}
@@ -0,0 +1,78 @@
+package report
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+func TestReportFlagsSafetyViolations(t *testing.T) {
+	parameters := consensus.Parameters{
+		Algorithm:           consensus.SlushAlgorithm,
+		K:                   3,
+		Alpha:               2,
+		MaxOutstandingItems: 1,
+		Rounds:              1,
+	}
+	// finalized are the data every node finalizes for every block
+	finalized := [][]string{
+		{"a", "a"},
+		{"a", "b"},
+		{"a", "a"},
+	}
+	var now time.Duration
+	r := NewRecorder(2, func() time.Duration {
+		return now
+	})
+	for node, blocks := range finalized {
+		nr := r.Node(node)
+		for index, data := range blocks {
+			c, err := consensus.NewConsensus(parameters, []byte("a"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c = nr.Observe(index, c)
+			now += time.Second
+			if err := c.RecordPoll([][]byte{[]byte(data), []byte(data), []byte(data)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	report := r.Report()
+	a, b := hex.EncodeToString([]byte("a")), hex.EncodeToString([]byte("b"))
+	want := []SafetyViolation{{
+		Index: 1,
+		Nodes: map[string][]int{a: {0, 2}, b: {1}},
+	}}
+	if !reflect.DeepEqual(report.SafetyViolations, want) {
+		t.Errorf("safety violations = %v, want %v", report.SafetyViolations, want)
+	}
+	if report.Finalized != 1 || report.AgreedBlocks != 1 || report.TotalFlips != 1 {
+		t.Errorf("finalized = %v, agreed blocks = %d, flips = %d, want 1, 1 and 1", report.Finalized, report.AgreedBlocks, report.TotalFlips)
+	}
+	if report.Finality.Max != 1 {
+		t.Errorf("the finality is %v, want every block finalized in a second", report.Finality)
+	}
+}
+
+func TestNewDistribution(t *testing.T) {
+	tests := []struct {
+		values []float64
+		want   Distribution
+	}{
+		{values: nil, want: Distribution{}},
+		{values: []float64{3}, want: Distribution{Count: 1, Mean: 3, Min: 3, P50: 3, P90: 3, P99: 3, Max: 3}},
+		{
+			values: []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5},
+			want:   Distribution{Count: 10, Mean: 5.5, Min: 1, P50: 5, P90: 9, P99: 10, Max: 10},
+		},
+	}
+	for _, tt := range tests {
+		if got := NewDistribution(tt.values); got != tt.want {
+			t.Errorf("NewDistribution(%v) = %+v, want %+v", tt.values, got, tt.want)
+		}
+	}
+}
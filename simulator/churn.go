@@ -0,0 +1,178 @@
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Crash never restarts the node when End is 0
+type Crash struct {
+	Node  int
+	Start time.Duration
+	End   time.Duration
+}
+
+type Churn struct {
+	Crashes []Crash
+	// Rate is the number of random crashes of every node per second while it decides blocks
+	Rate     float64
+	Downtime time.Duration
+	// LateJoiners are the last nodes, they start with no block
+	LateJoiners int
+	JoinAt      time.Duration
+}
+
+func (c *Churn) IsZero() bool {
+	return len(c.Crashes) == 0 && c.Rate == 0 && c.LateJoiners == 0
+}
+
+func (c *Churn) Verify(numOfNodes int) error {
+	for _, crash := range c.Crashes {
+		switch {
+		case crash.Node < 0 || crash.Node >= numOfNodes:
+			return fmt.Errorf("node = %d, numOfNodes = %d: fails the condition that: 0 <= node < numOfNodes", crash.Node, numOfNodes)
+		case crash.Start < 0:
+			return fmt.Errorf("start = %s: fails the condition that: 0 <= start", crash.Start)
+		case crash.End != 0 && crash.End <= crash.Start:
+			return fmt.Errorf("start = %s, end = %s: fails the condition that: start < end", crash.Start, crash.End)
+		}
+	}
+	switch {
+	case c.Rate < 0:
+		return fmt.Errorf("rate = %v: fails the condition that: 0 <= rate", c.Rate)
+	case c.Rate > 0 && c.Downtime <= 0:
+		return fmt.Errorf("downtime = %s: fails the condition that: 0 < downtime when the rate is set", c.Downtime)
+	case c.LateJoiners < 0 || c.LateJoiners >= numOfNodes:
+		return fmt.Errorf("lateJoiners = %d, numOfNodes = %d: fails the condition that: 0 <= lateJoiners < numOfNodes", c.LateJoiners, numOfNodes)
+	case c.JoinAt < 0:
+		return fmt.Errorf("joinAt = %s: fails the condition that: 0 <= joinAt", c.JoinAt)
+	}
+	return nil
+}
+
+func (c *Churn) IsLateJoiner(j, numOfNodes int) bool {
+	return j >= numOfNodes-c.LateJoiners
+}
+
+// NextCrash is exponentially distributed with the mean 1/Rate
+func (c *Churn) NextCrash(r *rand.Rand) time.Duration {
+	return time.Duration(r.ExpFloat64() / c.Rate * float64(time.Second))
+}
+
+func (s *Simulation) scheduleChurn() {
+	churn := &s.cfg.Churn
+	for _, crash := range churn.Crashes {
+		n := s.nodes[crash.Node]
+		if n.byzantine != nil {
+			continue
+		}
+		s.clock.After(crash.Start, func() {
+			s.crash(n)
+		})
+		if crash.End > 0 {
+			s.clock.After(crash.End, func() {
+				s.restart(n)
+			})
+		}
+	}
+	for _, n := range s.nodes {
+		if n.byzantine != nil {
+			continue
+		}
+		if n.down {
+			n := n
+			s.clock.After(churn.JoinAt, func() {
+				s.join(n)
+			})
+		}
+		if churn.Rate > 0 && !n.down {
+			s.scheduleRandomCrash(n)
+		}
+	}
+}
+
+// scheduleRandomCrash drops the crash when the node crashed in the meantime, the restart schedules the next one
+func (s *Simulation) scheduleRandomCrash(n *simNode) {
+	epoch := n.epoch
+	s.clock.AfterBackground(s.cfg.Churn.NextCrash(s.rand), func() {
+		if n.down || n.epoch != epoch || n.finished() {
+			return
+		}
+		s.crash(n)
+		s.clock.After(s.cfg.Churn.Downtime, func() {
+			s.restart(n)
+		})
+	})
+}
+
+// crash loses the decisions in progress but keeps the blocks and the decided ones
+func (s *Simulation) crash(n *simNode) {
+	if n.down {
+		return
+	}
+	n.down = true
+	n.epoch++
+	n.processing = make(map[int]*decision)
+	n.next = 0
+	n.parent = nil
+	s.crashes++
+	s.logf("node: %d crashed, decided blocks: %d/%d", n.id, n.numOfDecided(), len(n.blocks))
+}
+
+func (s *Simulation) restart(n *simNode) {
+	if !n.down {
+		return
+	}
+	n.down = false
+	s.logf("node: %d restarted, decided blocks: %d/%d", n.id, n.numOfDecided(), len(n.blocks))
+	s.start(n)
+}
+
+// join does not simulate the messages of the bootstrapping
+func (s *Simulation) join(n *simNode) {
+	n.down = false
+	reachable := s.reachable(n)
+	for index := range n.blocks {
+		for _, i := range s.rand.Perm(len(reachable)) {
+			peer := s.nodes[reachable[i]]
+			if peer == n {
+				continue
+			}
+			value, ok := peer.answer(n, index)
+			if !ok {
+				continue
+			}
+			s.counts[index][n.blocks[index][0]]--
+			n.blocks[index] = value
+			s.counts[index][n.blocks[index][0]]++
+			break
+		}
+	}
+	s.logf("node: %d joined, data: %s", n.id, n.state())
+	s.start(n)
+}
+
+func (s *Simulation) start(n *simNode) {
+	err := s.startDecisions(n)
+	if err != nil {
+		s.logf("node: %d, unable to start the blocks: %v", n.id, err)
+	}
+	if s.cfg.Churn.Rate > 0 {
+		s.scheduleRandomCrash(n)
+	}
+}
+
+func (n *simNode) finished() bool {
+	return n.numOfDecided() == len(n.decided)
+}
+
+func (n *simNode) numOfDecided() int {
+	decided := 0
+	for _, d := range n.decided {
+		if d {
+			decided++
+		}
+	}
+	return decided
+}
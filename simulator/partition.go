@@ -0,0 +1,66 @@
+package simulator
+
+import (
+	"fmt"
+	"time"
+)
+
+type Partition struct {
+	Start time.Duration
+	// the partition never heals when End is 0
+	End time.Duration
+	// the first group starts at the first node
+	Groups []int
+}
+
+func VerifyPartitions(partitions []Partition, numOfNodes int) error {
+	for i, p := range partitions {
+		switch {
+		case p.Start < 0:
+			return fmt.Errorf("start = %s: fails the condition that: 0 <= start", p.Start)
+		case p.End != 0 && p.End <= p.Start:
+			return fmt.Errorf("start = %s, end = %s: fails the condition that: start < end", p.Start, p.End)
+		case len(p.Groups) == 0:
+			return fmt.Errorf("the partition starting at %s has no group", p.Start)
+		}
+		inGroups := 0
+		for _, group := range p.Groups {
+			if group <= 0 {
+				return fmt.Errorf("group = %d: fails the condition that: 0 < group", group)
+			}
+			inGroups += group
+		}
+		if inGroups > numOfNodes {
+			return fmt.Errorf("numOfNodes = %d, nodes in groups = %d: fails the condition that: nodes in groups <= numOfNodes", numOfNodes, inGroups)
+		}
+		for _, other := range partitions[:i] {
+			if (other.End == 0 || p.Start < other.End) && (p.End == 0 || other.Start < p.End) {
+				return fmt.Errorf("the partitions starting at %s and %s overlap", other.Start, p.Start)
+			}
+		}
+	}
+	return nil
+}
+
+func (p *Partition) Active(now time.Duration) bool {
+	return now >= p.Start && (p.End == 0 || now < p.End)
+}
+
+func (p *Partition) Group(j int) int {
+	for i, group := range p.Groups {
+		if j < group {
+			return i
+		}
+		j -= group
+	}
+	return len(p.Groups)
+}
+
+func (p *Partition) Members(numOfNodes int) [][]int {
+	members := make([][]int, len(p.Groups)+1)
+	for j := 0; j < numOfNodes; j++ {
+		group := p.Group(j)
+		members[group] = append(members[group], j)
+	}
+	return members
+}
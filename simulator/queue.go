@@ -0,0 +1,93 @@
+package simulator
+
+import (
+	"container/heap"
+	"time"
+)
+
+type event struct {
+	at time.Duration
+	// seq orders the events scheduled at the same time
+	seq uint64
+	run func()
+	// background events do not keep the simulation running
+	background bool
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int {
+	return len(q)
+}
+
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q eventQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *eventQueue) Push(x interface{}) {
+	*q = append(*q, x.(*event))
+}
+
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return e
+}
+
+// Clock is the virtual clock of a simulation, it only moves forward when an event is processed
+type Clock struct {
+	now        time.Duration
+	seq        uint64
+	queue      eventQueue
+	foreground int
+}
+
+func (c *Clock) Now() time.Duration {
+	return c.now
+}
+
+func (c *Clock) After(delay time.Duration, run func()) {
+	c.schedule(delay, run, false)
+}
+
+// AfterBackground schedules an event that does not keep the simulation running
+func (c *Clock) AfterBackground(delay time.Duration, run func()) {
+	c.schedule(delay, run, true)
+}
+
+func (c *Clock) schedule(delay time.Duration, run func(), background bool) {
+	c.seq++
+	if !background {
+		c.foreground++
+	}
+	heap.Push(&c.queue, &event{
+		at:         c.now + delay,
+		seq:        c.seq,
+		run:        run,
+		background: background,
+	})
+}
+
+// Step returns false when only background events are left
+func (c *Clock) Step() bool {
+	if c.foreground == 0 {
+		return false
+	}
+	e := heap.Pop(&c.queue).(*event)
+	if !e.background {
+		c.foreground--
+	}
+	c.now = e.at
+	e.run()
+	return true
+}
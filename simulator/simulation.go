@@ -0,0 +1,508 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/byzantine"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/validators"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"time"
+)
+
+type Config struct {
+	// the same Seed always gives the same run
+	Seed                int64
+	NumOfNodes          int
+	NumOfBlocks         int
+	PossiblePreferences int
+	// every node starts with a uniformly random value when Split is 0
+	Split       float64
+	Parameters  consensus.Parameters
+	Concurrency int
+	// MinLatency and MaxLatency bound the one way delay of a message
+	MinLatency time.Duration
+	MaxLatency time.Duration
+	// MaxTime stops the simulation when the virtual clock reaches it, 0 means no limit
+	MaxTime time.Duration
+	// Links add to the uniform delay of the message, every link is perfect when it is nil
+	Links func(from, to int) p2p.LinkConditions
+	// Timeout is how long a node waits for a lost answer, twice MaxLatency when it is 0
+	Timeout time.Duration
+	// Byzantine makes the first nodes misbehave, they answer the queries but do not decide any block
+	Byzantine byzantine.Config
+	// a node only samples the nodes of its group during a partition
+	Partitions []Partition
+	Churn      Churn
+	// the nodes after the last weight have the stake 1, a node with the stake 0 is never sampled
+	Weights []uint64
+}
+
+func (c *Config) Verify() error {
+	switch {
+	case c.NumOfNodes < c.Parameters.K:
+		return fmt.Errorf("numOfNodes = %d, k = %d: fails the condition that: k <= numOfNodes", c.NumOfNodes, c.Parameters.K)
+	case c.NumOfBlocks <= 0:
+		return fmt.Errorf("numOfBlocks = %d: fails the condition that: 0 < numOfBlocks", c.NumOfBlocks)
+	case c.PossiblePreferences <= 0 || c.PossiblePreferences > 256:
+		return fmt.Errorf("possiblePreferences = %d: fails the condition that: 0 < possiblePreferences <= 256", c.PossiblePreferences)
+	case c.MinLatency < 0 || c.MaxLatency < c.MinLatency:
+		return fmt.Errorf("minLatency = %s, maxLatency = %s: fails the condition that: 0 <= minLatency <= maxLatency", c.MinLatency, c.MaxLatency)
+	case c.Timeout < 0:
+		return fmt.Errorf("timeout = %s: fails the condition that: 0 <= timeout", c.Timeout)
+	case c.Split < 0 || c.Split > 1:
+		return fmt.Errorf("split = %v: fails the condition that: 0 <= split <= 1", c.Split)
+	case c.Split > 0 && c.PossiblePreferences < 2:
+		return fmt.Errorf("possiblePreferences = %d: fails the condition that: 2 <= possiblePreferences when a split is set", c.PossiblePreferences)
+	}
+	err := c.Byzantine.Verify()
+	if err != nil {
+		return err
+	}
+	err = VerifyPartitions(c.Partitions, c.NumOfNodes)
+	if err != nil {
+		return err
+	}
+	err = c.Churn.Verify(c.NumOfNodes)
+	if err != nil {
+		return err
+	}
+	validators := 0
+	for i := 0; i < c.NumOfNodes; i++ {
+		if c.weight(i) > 0 {
+			validators++
+		}
+	}
+	if validators < c.Parameters.K {
+		return fmt.Errorf("validators = %d, k = %d: fails the condition that: k <= validators", validators, c.Parameters.K)
+	}
+	return c.Parameters.Verify()
+}
+
+func (c *Config) weight(i int) uint64 {
+	if i < len(c.Weights) {
+		return c.Weights[i]
+	}
+	return 1
+}
+
+// querySize is the size in bytes of a query, the size of an answer adds the size of the data
+const querySize = 16
+
+// Simulation runs the nodes in a single goroutine driven by a virtual clock
+type Simulation struct {
+	cfg   Config
+	rand  *rand.Rand
+	clock *Clock
+	nodes []*simNode
+	// counts are the number of honest nodes preferring every value of every block
+	counts  []map[byte]int
+	members [][][]int
+	// partition is the index of the active partition, -1 when the network is not partitioned
+	partition int
+	all       []int
+	recorder  *report.Recorder
+	crashes   int
+	out       io.Writer
+	// busyUntil is the virtual time every directed link finishes transmitting its messages
+	busyUntil map[[2]int]time.Duration
+}
+
+type simNode struct {
+	id         int
+	blocks     [][]byte
+	processing map[int]*decision
+	next       int
+	parent     consensus.Consensus
+	// decided are persisted so a restarted node does not decide them again
+	decided []bool
+	// a down node neither polls nor answers
+	down bool
+	// epoch counts the restarts, the polls of a previous epoch are dropped
+	epoch     int
+	byzantine *byzantine.Byzantine
+	recorder  *report.NodeRecorder
+}
+
+type decision struct {
+	index     int
+	consensus consensus.Consensus
+}
+
+type poll struct {
+	decision    *decision
+	preferences [][]byte
+	weights     []uint64
+	pending     int
+	epoch       int
+}
+
+type Result struct {
+	Seed      int64
+	Duration  time.Duration
+	Blocks    [][][]byte
+	Byzantine []bool
+	// Finished is false when MaxTime was reached before every node decided every block
+	Finished bool
+	// Healed is 0 if no partition healed
+	Healed  time.Duration
+	Crashes int
+	Report  *report.Report
+}
+
+// NewSimulation logs to os.Stdout when the output is nil
+func NewSimulation(cfg Config, out io.Writer) (*Simulation, error) {
+	err := cfg.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the simulation config")
+	}
+	if out == nil {
+		out = os.Stdout
+	}
+	members := make([][][]int, len(cfg.Partitions))
+	for i := range cfg.Partitions {
+		members[i] = cfg.Partitions[i].Members(cfg.NumOfNodes)
+	}
+	clock := &Clock{}
+	return &Simulation{
+		cfg:       cfg,
+		rand:      rand.New(rand.NewSource(cfg.Seed)),
+		clock:     clock,
+		members:   members,
+		partition: -1,
+		recorder:  report.NewRecorder(cfg.NumOfBlocks, clock.Now),
+		out:       out,
+		busyUntil: make(map[[2]int]time.Duration),
+	}, nil
+}
+
+func (s *Simulation) Run() (*Result, error) {
+	s.nodes = make([]*simNode, s.cfg.NumOfNodes)
+	numOfByzantine := s.cfg.Byzantine.NumOfNodes(s.cfg.NumOfNodes)
+	for i := range s.nodes {
+		n := &simNode{
+			id:         i,
+			blocks:     make([][]byte, s.cfg.NumOfBlocks),
+			processing: make(map[int]*decision),
+			decided:    make([]bool, s.cfg.NumOfBlocks),
+		}
+		if s.cfg.Split == 0 {
+			for j := range n.blocks {
+				n.blocks[j] = []byte{byte(s.rand.Intn(s.cfg.PossiblePreferences)), byte(j)}
+			}
+		}
+		if i < numOfByzantine {
+			b, err := byzantine.New(s.cfg.Byzantine, s.cfg.PossiblePreferences, s.rand, s.view)
+			if err != nil {
+				return nil, errors.Wrap(err, "unable to create the byzantine node")
+			}
+			n.byzantine = b
+		} else {
+			n.recorder = s.recorder.Node(i)
+			n.down = s.cfg.Churn.IsLateJoiner(i, s.cfg.NumOfNodes)
+		}
+		s.nodes[i] = n
+	}
+	if s.cfg.Split > 0 {
+		s.splitValues()
+	}
+	for i, n := range s.nodes {
+		s.logf("before sync, data of node: %d is %s", i, n.state())
+	}
+	s.counts = make([]map[byte]int, s.cfg.NumOfBlocks)
+	for index := range s.counts {
+		s.counts[index] = make(map[byte]int)
+		for _, n := range s.nodes {
+			if n.byzantine == nil {
+				s.counts[index][n.blocks[index][0]]++
+			}
+		}
+	}
+	for _, n := range s.nodes {
+		if n.byzantine != nil || n.down {
+			continue
+		}
+		err := s.startDecisions(n)
+		if err != nil {
+			return nil, err
+		}
+	}
+	s.scheduleChurn()
+
+	for s.clock.Step() {
+		if s.cfg.MaxTime > 0 && s.clock.Now() >= s.cfg.MaxTime {
+			s.logf("the simulation reached the max time")
+			break
+		}
+	}
+
+	result := &Result{
+		Seed:      s.cfg.Seed,
+		Duration:  s.clock.Now(),
+		Blocks:    make([][][]byte, len(s.nodes)),
+		Byzantine: make([]bool, len(s.nodes)),
+		Finished:  true,
+		Crashes:   s.crashes,
+		Report:    s.recorder.Report(),
+	}
+	for i, n := range s.nodes {
+		result.Blocks[i] = n.blocks
+		if n.byzantine != nil {
+			result.Byzantine[i] = true
+			s.logf("byzantine node: %d (%s), block: %s", i, n.byzantine.Strategy(), n.state())
+			continue
+		}
+		result.Finished = result.Finished && !n.down && n.next == len(n.blocks) && len(n.processing) == 0
+		s.logf("node: %d, block: %s", i, n.state())
+	}
+	for _, p := range s.cfg.Partitions {
+		if p.End != 0 && p.End <= result.Duration && p.End > result.Healed {
+			result.Healed = p.End
+		}
+	}
+	if result.Healed > 0 && result.Finished {
+		s.logf("every node decided every block %s after the last partition healed", result.Duration-result.Healed)
+	}
+	return result, nil
+}
+
+// splitValues gives the first value of every block to Split of the nodes picked at random
+func (s *Simulation) splitValues() {
+	first := int(math.Round(s.cfg.Split * float64(len(s.nodes))))
+	for j := 0; j < s.cfg.NumOfBlocks; j++ {
+		for rank, i := range s.rand.Perm(len(s.nodes)) {
+			value := 0
+			if rank >= first {
+				value = 1 + s.rand.Intn(s.cfg.PossiblePreferences-1)
+			}
+			s.nodes[i].blocks[j] = []byte{byte(value), byte(j)}
+		}
+	}
+}
+
+func (s *Simulation) startDecisions(n *simNode) error {
+	concurrency := s.cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	for n.next < len(n.blocks) && len(n.processing) < concurrency {
+		index := n.next
+		n.next++
+		if n.decided[index] {
+			continue
+		}
+		c, err := consensus.NewConsensus(s.cfg.Parameters, n.blocks[index], n.parent)
+		if err != nil {
+			return err
+		}
+		d := &decision{
+			index:     index,
+			consensus: n.recorder.Observe(index, c),
+		}
+		n.processing[index] = d
+		n.parent = c
+		for r := 0; r < s.cfg.Parameters.Repolls(); r++ {
+			s.startPoll(n, d)
+		}
+	}
+	return nil
+}
+
+// startPoll gets every answer back after two network delays
+func (s *Simulation) startPoll(n *simNode, d *decision) {
+	p := &poll{
+		decision: d,
+		pending:  s.cfg.Parameters.K,
+		epoch:    n.epoch,
+	}
+	// the querier gives up on a peer once its answer should have arrived
+	lost := func() {
+		s.clock.After(s.timeout(), func() {
+			s.receive(n, p, nil, 0)
+		})
+	}
+	reachable := s.reachable(n)
+	sampled := s.sample(reachable)
+	if len(sampled) > s.cfg.Parameters.K {
+		sampled = sampled[:s.cfg.Parameters.K]
+	}
+	p.pending = len(sampled)
+	for _, i := range sampled {
+		peer := s.nodes[reachable[i]]
+		delay, dropped := s.transmit(n, peer, querySize)
+		if dropped {
+			lost()
+			continue
+		}
+		s.clock.After(delay, func() {
+			answer, ok := peer.answer(n, d.index)
+			if !ok {
+				lost()
+				return
+			}
+			delay, dropped := s.transmit(peer, n, querySize+len(answer))
+			if dropped {
+				lost()
+				return
+			}
+			s.clock.After(delay, func() {
+				s.receive(n, p, answer, s.cfg.weight(peer.id))
+			})
+		})
+	}
+}
+
+func (s *Simulation) sample(nodes []int) []int {
+	if s.cfg.Weights == nil {
+		return s.rand.Perm(len(nodes))
+	}
+	weights := make([]uint64, len(nodes))
+	for i, id := range nodes {
+		weights[i] = s.cfg.weight(id)
+	}
+	return validators.Sample(s.rand, weights)
+}
+
+func (s *Simulation) reachable(n *simNode) []int {
+	active := -1
+	for i := range s.cfg.Partitions {
+		if s.cfg.Partitions[i].Active(s.clock.Now()) {
+			active = i
+		}
+	}
+	if active != s.partition {
+		if active == -1 {
+			s.logf("the partition is healed")
+		} else {
+			groups := 0
+			for _, members := range s.members[active] {
+				if len(members) > 0 {
+					groups++
+				}
+			}
+			s.logf("the nodes are partitioned in %d groups", groups)
+		}
+		s.partition = active
+	}
+	if active == -1 {
+		if s.all == nil {
+			s.all = make([]int, len(s.nodes))
+			for i := range s.all {
+				s.all[i] = i
+			}
+		}
+		return s.all
+	}
+	p := &s.cfg.Partitions[active]
+	return s.members[active][p.Group(n.id)]
+}
+
+// answer returns false when the node does not answer, like a crashed node
+func (n *simNode) answer(querier *simNode, index int) ([]byte, bool) {
+	if n.down {
+		return nil, false
+	}
+	if n.byzantine == nil {
+		return n.blocks[index], true
+	}
+	return n.byzantine.RespondData(fmt.Sprintf("node-%d", querier.id), index, n.blocks[index])
+}
+
+func (s *Simulation) view(index int) map[byte]int {
+	return s.counts[index]
+}
+
+// receive records the poll once every sampled node answered or timed out.
+// A lost answer counts as no vote, so a poll fails when too many answers are lost.
+func (s *Simulation) receive(n *simNode, p *poll, answer []byte, weight uint64) {
+	// the node lost its polls when it crashed
+	if n.down || p.epoch != n.epoch {
+		return
+	}
+	if answer != nil {
+		p.preferences = append(p.preferences, answer)
+		p.weights = append(p.weights, weight)
+	}
+	p.pending--
+	if p.pending > 0 {
+		return
+	}
+	d := p.decision
+	if d.consensus.Finalized() {
+		return
+	}
+	if len(p.preferences) == 0 {
+		s.startPoll(n, d)
+		return
+	}
+	preferences := p.preferences
+	if s.cfg.Parameters.StakeAlpha {
+		preferences = consensus.WeighPoll(preferences, p.weights)
+	}
+	oldPreference := d.consensus.Preference()
+	err := d.consensus.RecordPoll(preferences)
+	if err != nil {
+		s.logf("node: %d, unable to record the poll of block %d: %v", n.id, d.index, err)
+	}
+	if !bytes.Equal(oldPreference, d.consensus.Preference()) {
+		s.counts[d.index][n.blocks[d.index][0]]--
+		n.blocks[d.index] = d.consensus.Preference()
+		s.counts[d.index][n.blocks[d.index][0]]++
+	}
+	if !d.consensus.Finalized() {
+		s.startPoll(n, d)
+		return
+	}
+	delete(n.processing, d.index)
+	n.decided[d.index] = true
+	err = s.startDecisions(n)
+	if err != nil {
+		s.logf("node: %d, unable to start the next block: %v", n.id, err)
+	}
+}
+
+// transmit returns true if the message is lost
+func (s *Simulation) transmit(from, to *simNode, size int) (time.Duration, bool) {
+	delay := s.latency()
+	if s.cfg.Links == nil {
+		return delay, false
+	}
+	link := s.cfg.Links(from.id, to.id)
+	key := [2]int{from.id, to.id}
+	linkDelay, busyUntil := link.Delay(s.rand, s.clock.Now(), s.busyUntil[key], size)
+	s.busyUntil[key] = busyUntil
+	return delay + linkDelay, link.Drop(s.rand)
+}
+
+func (s *Simulation) timeout() time.Duration {
+	if s.cfg.Timeout > 0 {
+		return s.cfg.Timeout
+	}
+	return 2 * s.cfg.MaxLatency
+}
+
+func (s *Simulation) latency() time.Duration {
+	spread := s.cfg.MaxLatency - s.cfg.MinLatency
+	if spread <= 0 {
+		return s.cfg.MinLatency
+	}
+	return s.cfg.MinLatency + time.Duration(s.rand.Int63n(int64(spread)+1))
+}
+
+func (s *Simulation) logf(format string, v ...interface{}) {
+	_, _ = fmt.Fprintf(s.out, "[%12s] %s\n", s.clock.Now(), fmt.Sprintf(format, v...))
+}
+
+func (n *simNode) state() string {
+	state := ""
+	for _, b := range n.blocks {
+		state += fmt.Sprintf("%d", b[0])
+	}
+	return state
+}
@@ -0,0 +1,149 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/byzantine"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+func testConfig() Config {
+	return Config{
+		Seed:                1,
+		NumOfNodes:          20,
+		NumOfBlocks:         5,
+		PossiblePreferences: 2,
+		Parameters: consensus.Parameters{
+			K:                   5,
+			Alpha:               4,
+			BetaVirtuous:        3,
+			BetaRogue:           5,
+			ConcurrentRepolls:   1,
+			MaxOutstandingItems: 64,
+		},
+		Concurrency: 2,
+		MinLatency:  10 * time.Millisecond,
+		MaxLatency:  50 * time.Millisecond,
+		MaxTime:     time.Minute,
+		Byzantine:   byzantine.Config{Strategy: byzantine.Honest},
+	}
+}
+
+func TestSimulationIsDeterministic(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *Config)
+	}{
+		{name: "honest nodes", config: func(cfg *Config) {}},
+		{name: "lossy links", config: func(cfg *Config) {
+			cfg.Links = func(from, to int) p2p.LinkConditions {
+				return p2p.LinkConditions{Latency: 20 * time.Millisecond, Jitter: 10 * time.Millisecond, DropProbability: 0.1, Bandwidth: 1 << 12}
+			}
+		}},
+		{name: "byzantine nodes", config: func(cfg *Config) {
+			cfg.Byzantine = byzantine.Config{Strategy: byzantine.Random, Fraction: 0.2}
+		}},
+		{name: "partition and churn", config: func(cfg *Config) {
+			cfg.Partitions = []Partition{{Start: 0, End: 2 * time.Second, Groups: []int{10, 10}}}
+			cfg.Churn = Churn{Rate: 0.5, Downtime: time.Second, LateJoiners: 2, JoinAt: time.Second}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs := make([]bytes.Buffer, 2)
+			results := make([]*Result, 2)
+			for i := range results {
+				cfg := testConfig()
+				tt.config(&cfg)
+				s, err := NewSimulation(cfg, &outputs[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				results[i], err = s.Run()
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !results[0].Finished {
+				t.Error("the nodes did not decide every block")
+			}
+			if !bytes.Equal(outputs[0].Bytes(), outputs[1].Bytes()) {
+				t.Error("the outputs of the runs differ")
+			}
+			if !reflect.DeepEqual(results[0], results[1]) {
+				t.Error("the results of the runs differ")
+			}
+		})
+	}
+}
+
+func TestBalancingAttackKeepsTheSplit(t *testing.T) {
+	tests := []struct {
+		strategy byzantine.Strategy
+		split    bool
+	}{
+		{strategy: byzantine.Honest},
+		{strategy: byzantine.Balancing, split: true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.strategy), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Split = 0.5
+			cfg.MaxTime = 30 * time.Second
+			cfg.Byzantine = byzantine.Config{Strategy: tt.strategy, Fraction: 0.3}
+			s, err := NewSimulation(cfg, &bytes.Buffer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := s.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a block is split when the honest nodes hold different values for it at the end
+			split := false
+			for index := 0; index < cfg.NumOfBlocks; index++ {
+				values := make(map[byte]bool)
+				for i, blocks := range result.Blocks {
+					if !result.Byzantine[i] {
+						values[blocks[index][0]] = true
+					}
+				}
+				split = split || len(values) > 1
+			}
+			if split != tt.split || result.Finished == tt.split {
+				t.Errorf("split = %v, finished = %v, want the split to be kept = %v", split, result.Finished, tt.split)
+			}
+		})
+	}
+}
+
+func TestPartitionNeverFinalizesConflictingValues(t *testing.T) {
+	for seed := int64(1); seed <= 5; seed++ {
+		t.Run(fmt.Sprintf("seed=%d", seed), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Seed = seed
+			cfg.Split = 0.5
+			// the minority group is smaller than alpha, it cannot finalize a block before the partition heals
+			cfg.Partitions = []Partition{{Start: 0, End: 5 * time.Second, Groups: []int{17, 3}}}
+			s, err := NewSimulation(cfg, &bytes.Buffer{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := s.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Finished || result.Healed != 5*time.Second {
+				t.Errorf("finished = %v, healed = %s, want every block decided after the partition healed", result.Finished, result.Healed)
+			}
+			if violations := result.Report.SafetyViolations; len(violations) > 0 {
+				t.Errorf("the honest nodes finalized conflicting values: %v", violations)
+			}
+		})
+	}
+}
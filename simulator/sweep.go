@@ -0,0 +1,164 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"io"
+	"strconv"
+	"sync"
+)
+
+type Cell struct {
+	Parameters        consensus.Parameters
+	NumOfNodes        int
+	ByzantineFraction float64
+	Split             float64
+	ChurnRate         float64
+}
+
+type CellResult struct {
+	Cell
+	Runs int
+	// Unfinished runs reached MaxTime before every honest node decided every block
+	Unfinished int
+	// Unsafe runs finalized different data for the same block
+	Unsafe int
+	// Finality is in seconds of virtual time
+	Finality report.Distribution
+	// BlockFinality is from the first poll of a block
+	BlockFinality float64
+	Agreement     float64
+	Crashes       float64
+}
+
+// Sweep spreads the runs over workers goroutines
+func Sweep(base Config, cells []Cell, repeats, workers int) ([]CellResult, error) {
+	if workers <= 0 {
+		workers = 1
+	}
+	results := make([][]*Result, len(cells))
+	for i := range results {
+		results[i] = make([]*Result, repeats)
+	}
+	type run struct {
+		cell, repeat int
+	}
+	runs := make(chan run)
+	var mu sync.Mutex
+	var sweepErr error
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range runs {
+				cfg := base
+				cfg.Seed = base.Seed + int64(r.repeat)
+				cfg.Parameters = cells[r.cell].Parameters
+				cfg.NumOfNodes = cells[r.cell].NumOfNodes
+				cfg.Byzantine.Fraction = cells[r.cell].ByzantineFraction
+				cfg.Split = cells[r.cell].Split
+				cfg.Churn.Rate = cells[r.cell].ChurnRate
+				simulation, err := NewSimulation(cfg, io.Discard)
+				if err == nil {
+					results[r.cell][r.repeat], err = simulation.Run()
+				}
+				if err != nil {
+					mu.Lock()
+					sweepErr = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for cell := range cells {
+		for repeat := 0; repeat < repeats; repeat++ {
+			runs <- run{cell: cell, repeat: repeat}
+		}
+	}
+	close(runs)
+	wg.Wait()
+	if sweepErr != nil {
+		return nil, errors.Wrap(sweepErr, "unable to run the simulation of the sweep")
+	}
+
+	aggregated := make([]CellResult, len(cells))
+	for i, cell := range cells {
+		aggregated[i] = aggregate(cell, results[i])
+	}
+	return aggregated, nil
+}
+
+func aggregate(cell Cell, runs []*Result) CellResult {
+	result := CellResult{
+		Cell: cell,
+		Runs: len(runs),
+	}
+	durations := make([]float64, 0, len(runs))
+	blockFinality, finalized := 0.0, 0
+	for _, run := range runs {
+		if run.Finished {
+			durations = append(durations, run.Duration.Seconds())
+		} else {
+			result.Unfinished++
+		}
+		if len(run.Report.SafetyViolations) > 0 {
+			result.Unsafe++
+		}
+		blockFinality += run.Report.Finality.Mean * float64(run.Report.Finality.Count)
+		finalized += run.Report.Finality.Count
+		result.Agreement += run.Report.Agreement / float64(len(runs))
+		result.Crashes += float64(run.Crashes) / float64(len(runs))
+	}
+	if finalized > 0 {
+		result.BlockFinality = blockFinality / float64(finalized)
+	}
+	result.Finality = report.NewDistribution(durations)
+	return result
+}
+
+// WriteCSV writes the rates as fractions of the runs of a cell
+func WriteCSV(w io.Writer, results []CellResult) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write([]string{
+		"k", "alpha", "beta_virtuous", "beta_rogue", "nodes", "byzantine_fraction", "split", "churn_rate", "runs",
+		"finality_mean", "finality_p50", "finality_p90", "finality_p99", "finality_max",
+		"block_finality_mean", "agreement_mean", "crashes_mean", "unfinished_rate", "unsafe_rate",
+	})
+	if err != nil {
+		return err
+	}
+	formatFloat := func(f float64) string {
+		return strconv.FormatFloat(f, 'f', 6, 64)
+	}
+	for _, r := range results {
+		err = writer.Write([]string{
+			strconv.Itoa(r.Parameters.K),
+			strconv.Itoa(r.Parameters.Alpha),
+			strconv.Itoa(r.Parameters.BetaVirtuous),
+			strconv.Itoa(r.Parameters.BetaRogue),
+			strconv.Itoa(r.NumOfNodes),
+			formatFloat(r.ByzantineFraction),
+			formatFloat(r.Split),
+			formatFloat(r.ChurnRate),
+			strconv.Itoa(r.Runs),
+			formatFloat(r.Finality.Mean),
+			formatFloat(r.Finality.P50),
+			formatFloat(r.Finality.P90),
+			formatFloat(r.Finality.P99),
+			formatFloat(r.Finality.Max),
+			formatFloat(r.BlockFinality),
+			formatFloat(r.Agreement),
+			formatFloat(r.Crashes),
+			formatFloat(float64(r.Unfinished) / float64(r.Runs)),
+			formatFloat(float64(r.Unsafe) / float64(r.Runs)),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
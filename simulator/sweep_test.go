@@ -0,0 +1,63 @@
+package simulator
+
+import (
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
+)
+
+func TestSweepPercentiles(t *testing.T) {
+	const repeats = 5
+	base := testConfig()
+	cells := make([]Cell, 0)
+	for _, k := range []int{5, 7} {
+		parameters := base.Parameters
+		parameters.K = k
+		parameters.Alpha = k - 1
+		cells = append(cells, Cell{Parameters: parameters, NumOfNodes: base.NumOfNodes, Split: 0.6})
+	}
+
+	// the finality of every cell is the distribution of the durations of its runs with the seeds base.Seed, base.Seed+1, ...
+	want := make([]report.Distribution, len(cells))
+	for i, cell := range cells {
+		durations := make([]float64, 0, repeats)
+		for repeat := 0; repeat < repeats; repeat++ {
+			cfg := base
+			cfg.Seed = base.Seed + int64(repeat)
+			cfg.Parameters, cfg.Split = cell.Parameters, cell.Split
+			s, err := NewSimulation(cfg, io.Discard)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := s.Run()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Finished {
+				t.Fatalf("cell %d, seed %d: the run did not finish", i, cfg.Seed)
+			}
+			durations = append(durations, result.Duration.Seconds())
+		}
+		want[i] = report.NewDistribution(durations)
+	}
+
+	var previous []CellResult
+	for _, workers := range []int{1, 4} {
+		results, err := Sweep(base, cells, repeats, workers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, result := range results {
+			if result.Runs != repeats || result.Unfinished != 0 || result.Finality != want[i] {
+				t.Errorf("workers = %d, cell %d: runs = %d, unfinished = %d, finality = %+v, want %d finished runs with %+v",
+					workers, i, result.Runs, result.Unfinished, result.Finality, repeats, want[i])
+			}
+		}
+		if previous != nil && !reflect.DeepEqual(results, previous) {
+			t.Errorf("workers = %d: the results depend on the number of workers", workers)
+		}
+		previous = results
+	}
+}
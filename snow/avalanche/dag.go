@@ -0,0 +1,508 @@
+package avalanche
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"sort"
+	"sync"
+)
+
+const maxParents = 5
+
+type Status int
+
+const (
+	Processing Status = iota
+	Accepted
+	Rejected
+)
+
+func (s Status) String() string {
+	switch s {
+	case Accepted:
+		return "accepted"
+	case Rejected:
+		return "rejected"
+	default:
+		return "processing"
+	}
+}
+
+type vertexNode struct {
+	vertex   *Vertex
+	parents  []*vertexNode
+	children []*vertexNode
+	chit     bool
+	// confidence is the number of chits in the progeny of the vertex, including itself
+	confidence int
+	status     Status
+}
+
+type txNode struct {
+	tx *Tx
+	// vertex is nil when the vertex was rejected and the transaction waits to be reissued
+	vertex *vertexNode
+	status Status
+}
+
+func (t *txNode) confidence() int {
+	if t.vertex == nil {
+		return 0
+	}
+	return t.vertex.confidence
+}
+
+// conflictSet is the set of transactions spending the same input, P_T in the paper
+type conflictSet struct {
+	txs        []*txNode
+	preference *txNode
+	last       *txNode
+	count      int
+}
+
+// DAG holds the vertices known by a node and decides their transactions
+//
+// Ref: https://docs.avax.network/overview/getting-started/avalanche-consensus
+type DAG struct {
+	mu         sync.RWMutex
+	parameters consensus.Parameters
+	vertices   map[string]*vertexNode
+	txs        map[string]*txNode
+	conflicts  map[string]*conflictSet
+	chits      int
+}
+
+func NewDAG(parameters consensus.Parameters) (*DAG, error) {
+	err := parameters.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the consensus configuration")
+	}
+	genesis := &vertexNode{
+		vertex: Genesis(),
+		status: Accepted,
+	}
+	return &DAG{
+		parameters: parameters,
+		vertices: map[string]*vertexNode{
+			genesis.vertex.ID: genesis,
+		},
+		txs:       make(map[string]*txNode),
+		conflicts: make(map[string]*conflictSet),
+	}, nil
+}
+
+func (d *DAG) Has(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.vertices[id]
+	return ok
+}
+
+func (d *DAG) Get(id string) (*Vertex, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	v, ok := d.vertices[id]
+	if !ok {
+		return nil, false
+	}
+	return v.vertex, true
+}
+
+func (d *DAG) MissingParents(vtx *Vertex) []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	missing := make([]string, 0)
+	for _, id := range vtx.ParentIDs {
+		if _, ok := d.vertices[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	return missing
+}
+
+// Add inserts the vertex into the DAG, all of its parents must have been added before
+func (d *DAG) Add(vtx *Vertex) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.vertices[vtx.ID]; ok {
+		return nil
+	}
+	node := &vertexNode{
+		vertex: vtx,
+		status: Processing,
+	}
+	parents := make([]*Vertex, 0, len(vtx.ParentIDs))
+	for _, id := range vtx.ParentIDs {
+		parent, ok := d.vertices[id]
+		if !ok {
+			return fmt.Errorf("the parent %s of the vertex is missing", id)
+		}
+		node.parents = append(node.parents, parent)
+		parents = append(parents, parent.vertex)
+	}
+	err := vtx.Verify(parents)
+	if err != nil {
+		return errors.Wrap(err, "unable to verify the vertex")
+	}
+	for _, parent := range node.parents {
+		parent.children = append(parent.children, node)
+	}
+	d.vertices[vtx.ID] = node
+
+	for _, tx := range vtx.Txs {
+		t, ok := d.txs[tx.ID]
+		if !ok {
+			t = &txNode{
+				tx:     tx,
+				vertex: node,
+				status: Processing,
+			}
+			d.txs[tx.ID] = t
+			for _, input := range tx.Inputs {
+				cs, ok := d.conflicts[input]
+				if !ok {
+					cs = &conflictSet{
+						preference: t,
+						last:       t,
+					}
+					d.conflicts[input] = cs
+				}
+				cs.txs = append(cs.txs, t)
+			}
+			continue
+		}
+		// the transaction was reissued after its vertex got rejected
+		if t.status == Processing && t.vertex == nil {
+			t.vertex = node
+		}
+	}
+	d.update()
+	return nil
+}
+
+func (d *DAG) RecordPoll(id string, votes int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	node, ok := d.vertices[id]
+	if !ok {
+		return fmt.Errorf("the vertex %s is unknown", id)
+	}
+	if node.status != Processing {
+		return nil
+	}
+	ancestors := d.ancestors(node)
+	if votes >= d.parameters.Alpha {
+		if node.chit {
+			return nil
+		}
+		node.chit = true
+		d.chits++
+		for _, u := range ancestors {
+			u.confidence++
+		}
+		for _, u := range ancestors {
+			for _, t := range d.ownedTxs(u) {
+				for _, cs := range d.conflictSets(t) {
+					if t.confidence() > cs.preference.confidence() {
+						cs.preference = t
+					}
+					if cs.last != t {
+						cs.last = t
+						cs.count = 1
+					} else {
+						cs.count++
+					}
+				}
+			}
+		}
+	} else {
+		for _, u := range ancestors {
+			for _, t := range d.ownedTxs(u) {
+				for _, cs := range d.conflictSets(t) {
+					cs.count = 0
+				}
+			}
+		}
+	}
+	d.update()
+	return nil
+}
+
+func (d *DAG) IsStronglyPreferred(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	node, ok := d.vertices[id]
+	if !ok {
+		return false
+	}
+	for _, u := range d.ancestors(node) {
+		if !d.isPreferredVertex(u) {
+			return false
+		}
+	}
+	return true
+}
+
+// Frontier returns the parents of the next issued vertex
+func (d *DAG) Frontier() []*Vertex {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	nodes := make([]*vertexNode, 0, len(d.vertices))
+	for _, node := range d.vertices {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].vertex.Height != nodes[j].vertex.Height {
+			return nodes[i].vertex.Height < nodes[j].vertex.Height
+		}
+		return nodes[i].vertex.ID < nodes[j].vertex.ID
+	})
+	// parents always come before their children, so one pass is enough
+	stronglyPreferred := make(map[*vertexNode]bool, len(nodes))
+	for _, node := range nodes {
+		preferred := d.isPreferredVertex(node)
+		for _, parent := range node.parents {
+			preferred = preferred && stronglyPreferred[parent]
+		}
+		stronglyPreferred[node] = preferred
+	}
+	frontier := make([]*Vertex, 0)
+	for i := len(nodes) - 1; i >= 0 && len(frontier) < maxParents; i-- {
+		node := nodes[i]
+		if !stronglyPreferred[node] {
+			continue
+		}
+		isFrontier := true
+		for _, child := range node.children {
+			if stronglyPreferred[child] {
+				isFrontier = false
+				break
+			}
+		}
+		if isFrontier {
+			frontier = append(frontier, node.vertex)
+		}
+	}
+	return frontier
+}
+
+func (d *DAG) Detached() []*Tx {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txs := make([]*Tx, 0)
+	for _, t := range d.txs {
+		if t.status == Processing && t.vertex == nil {
+			txs = append(txs, t.tx)
+		}
+	}
+	sort.Slice(txs, func(i, j int) bool {
+		return txs[i].ID < txs[j].ID
+	})
+	return txs
+}
+
+func (d *DAG) isProcessing(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	node, ok := d.vertices[id]
+	return ok && node.status == Processing
+}
+
+func (d *DAG) NumChits() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.chits
+}
+
+func (d *DAG) NumProcessing() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	count := 0
+	for _, t := range d.txs {
+		if t.status == Processing {
+			count++
+		}
+	}
+	return count
+}
+
+func (d *DAG) TxStatus(id string) Status {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	t, ok := d.txs[id]
+	if !ok {
+		return Processing
+	}
+	return t.status
+}
+
+func (d *DAG) AcceptedTx(input string) (*Tx, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	cs, ok := d.conflicts[input]
+	if !ok {
+		return nil, false
+	}
+	for _, t := range cs.txs {
+		if t.status == Accepted {
+			return t.tx, true
+		}
+	}
+	return nil, false
+}
+
+func (d *DAG) Inputs() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	inputs := make([]string, 0, len(d.conflicts))
+	for input := range d.conflicts {
+		inputs = append(inputs, input)
+	}
+	sort.Strings(inputs)
+	return inputs
+}
+
+func (d *DAG) ancestors(node *vertexNode) []*vertexNode {
+	visited := map[*vertexNode]bool{node: true}
+	queue := []*vertexNode{node}
+	for i := 0; i < len(queue); i++ {
+		for _, parent := range queue[i].parents {
+			if visited[parent] || parent.status == Accepted {
+				continue
+			}
+			visited[parent] = true
+			queue = append(queue, parent)
+		}
+	}
+	return queue
+}
+
+// ownedTxs returns the processing transactions that take their confidence from the vertex
+func (d *DAG) ownedTxs(node *vertexNode) []*txNode {
+	txs := make([]*txNode, 0, len(node.vertex.Txs))
+	for _, tx := range node.vertex.Txs {
+		t := d.txs[tx.ID]
+		if t.status == Processing && t.vertex == node {
+			txs = append(txs, t)
+		}
+	}
+	return txs
+}
+
+func (d *DAG) conflictSets(t *txNode) []*conflictSet {
+	sets := make([]*conflictSet, 0, len(t.tx.Inputs))
+	for _, input := range t.tx.Inputs {
+		sets = append(sets, d.conflicts[input])
+	}
+	return sets
+}
+
+func (d *DAG) isPreferred(t *txNode) bool {
+	for _, cs := range d.conflictSets(t) {
+		if cs.preference != t {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *DAG) isPreferredVertex(node *vertexNode) bool {
+	if node.status == Accepted {
+		return true
+	}
+	if node.status == Rejected {
+		return false
+	}
+	for _, tx := range node.vertex.Txs {
+		t := d.txs[tx.ID]
+		if t.status == Rejected || (t.status == Processing && !d.isPreferred(t)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAcceptable applies BetaVirtuous to the confidence of a virtuous transaction, BetaRogue to a rogue one
+func (d *DAG) isAcceptable(t *txNode) bool {
+	virtuous, rogue := true, true
+	for _, cs := range d.conflictSets(t) {
+		if len(cs.txs) > 1 {
+			virtuous = false
+		}
+		if cs.preference != t || cs.count < d.parameters.BetaRogue {
+			rogue = false
+		}
+	}
+	return (virtuous && t.confidence() >= d.parameters.BetaVirtuous) || rogue
+}
+
+// update only accepts the transactions of a vertex with the vertex, an accepted transaction never sits in a rejected vertex
+func (d *DAG) update() {
+	for changed := true; changed; {
+		changed = false
+		for _, node := range d.vertices {
+			if node.status != Processing {
+				continue
+			}
+			switch {
+			case d.isRejectedVertex(node):
+				node.status = Rejected
+				for _, t := range d.ownedTxs(node) {
+					t.vertex = nil
+				}
+				changed = true
+			case d.isAcceptableVertex(node):
+				d.accept(node)
+				changed = true
+			}
+		}
+	}
+}
+
+func (d *DAG) isRejectedVertex(node *vertexNode) bool {
+	for _, parent := range node.parents {
+		if parent.status == Rejected {
+			return true
+		}
+	}
+	for _, tx := range node.vertex.Txs {
+		if d.txs[tx.ID].status == Rejected {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *DAG) isAcceptableVertex(node *vertexNode) bool {
+	for _, parent := range node.parents {
+		if parent.status != Accepted {
+			return false
+		}
+	}
+	for _, tx := range node.vertex.Txs {
+		t := d.txs[tx.ID]
+		if t.status != Accepted && !d.isAcceptable(t) {
+			return false
+		}
+	}
+	return true
+}
+
+func (d *DAG) accept(node *vertexNode) {
+	for _, tx := range node.vertex.Txs {
+		t := d.txs[tx.ID]
+		if t.status != Processing {
+			continue
+		}
+		t.status = Accepted
+		for _, cs := range d.conflictSets(t) {
+			for _, conflict := range cs.txs {
+				if conflict != t && conflict.status == Processing {
+					conflict.status = Rejected
+				}
+			}
+		}
+	}
+	node.status = Accepted
+}
@@ -0,0 +1,68 @@
+package avalanche
+
+import (
+	"testing"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+func TestDAGAcceptsTransactionsWithTheirVertex(t *testing.T) {
+	dag, err := NewDAG(consensus.Parameters{
+		K:                   1,
+		Alpha:               1,
+		BetaVirtuous:        1,
+		BetaRogue:           2,
+		ConcurrentRepolls:   1,
+		MaxOutstandingItems: 64,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := Genesis()
+	virtuous := NewTx([]string{"x"}, []byte("virtuous"))
+	loser := NewTx([]string{"y"}, []byte("loser"))
+	winner := NewTx([]string{"y"}, []byte("winner"))
+	v1 := NewVertex([]*Vertex{genesis}, []*Tx{virtuous, loser})
+	v2 := NewVertex([]*Vertex{genesis}, []*Tx{winner})
+	for _, vtx := range []*Vertex{v1, v2} {
+		if err := dag.Add(vtx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the virtuous transaction reached BetaVirtuous but the conflict of its vertex is undecided
+	if err := dag.RecordPoll(v1.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	if status := dag.TxStatus(virtuous.ID); status != Processing {
+		t.Fatalf("the virtuous transaction is %s before its vertex is acceptable", status)
+	}
+
+	// the conflicting transaction wins, the first vertex is rejected
+	if err := dag.RecordPoll(v2.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	v3 := NewVertex([]*Vertex{v2}, nil)
+	if err := dag.Add(v3); err != nil {
+		t.Fatal(err)
+	}
+	if err := dag.RecordPoll(v3.ID, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		tx     *Tx
+		status Status
+	}{
+		{tx: winner, status: Accepted},
+		{tx: loser, status: Rejected},
+		{tx: virtuous, status: Processing},
+	} {
+		if status := dag.TxStatus(tt.tx.ID); status != tt.status {
+			t.Errorf("the transaction %s is %s, want %s", tt.tx.Data, status, tt.status)
+		}
+	}
+	detached := dag.Detached()
+	if len(detached) != 1 || detached[0].ID != virtuous.ID {
+		t.Errorf("detached = %v, want the virtuous transaction to be reissued", detached)
+	}
+}
@@ -0,0 +1,406 @@
+package avalanche
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/validators"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	minRetryWait        = 50 * time.Millisecond
+	maxRetryWait        = 2 * time.Second
+	maxMissingAncestors = 256
+)
+
+type PushVertexRequest struct {
+	Vertex *Vertex `json:"vertex"`
+}
+
+type PushQueryResponse struct {
+	Chit bool `json:"chit"`
+}
+
+type GetVertexRequest struct {
+	ID string `json:"id"`
+}
+
+type GetVertexResponse struct {
+	Vertex *Vertex `json:"vertex"`
+}
+
+// Engine gossips issued vertices and polls k random peers for every vertex
+type Engine struct {
+	dag      *DAG
+	client   *p2p.Client
+	rand     *rand.Rand
+	mu       sync.Mutex
+	unpolled []string
+	// pending wait for the processing transactions to drop below MaxOutstandingItems
+	pending   []*Tx
+	responder func(from string, chit bool) (bool, bool)
+}
+
+func NewEngine(parameters consensus.Parameters, seed int64) (*Engine, error) {
+	dag, err := NewDAG(parameters)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		dag:      dag,
+		rand:     random.New(seed),
+		unpolled: make([]string, 0),
+		pending:  make([]*Tx, 0),
+	}, nil
+}
+
+func (e *Engine) SetClient(client *p2p.Client) {
+	e.client = client
+}
+
+// SetResponder lets the engine misbehave, the peer gets no answer when the responder returns false
+func (e *Engine) SetResponder(responder func(from string, chit bool) (bool, bool)) {
+	e.responder = responder
+}
+
+func (e *Engine) DAG() *DAG {
+	return e.dag
+}
+
+func (e *Engine) Router(t p2p.Transport) {
+	t.Register("avalanche/push-vertex", e.PushVertex)
+	t.Register("avalanche/push-query", e.PushQuery)
+	t.Register("avalanche/get-vertex", e.GetVertex)
+}
+
+func (e *Engine) PushVertex(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req PushVertexRequest
+	if err := json.Unmarshal(payload, &req); err != nil || req.Vertex == nil {
+		return nil, errors.New("invalid push vertex request")
+	}
+	err := e.receive(ctx, from, req.Vertex)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal("OK")
+}
+
+func (e *Engine) PushQuery(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req PushVertexRequest
+	if err := json.Unmarshal(payload, &req); err != nil || req.Vertex == nil {
+		return nil, errors.New("invalid push query request")
+	}
+	err := e.receive(ctx, from, req.Vertex)
+	if err != nil {
+		return nil, err
+	}
+	chit := e.dag.IsStronglyPreferred(req.Vertex.ID)
+	if e.responder != nil {
+		var ok bool
+		chit, ok = e.responder(from, chit)
+		if !ok {
+			return nil, errors.New("the peer does not answer")
+		}
+	}
+	return json.Marshal(PushQueryResponse{
+		Chit: chit,
+	})
+}
+
+func (e *Engine) GetVertex(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req GetVertexRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid get vertex request")
+	}
+	vtx, ok := e.dag.Get(req.ID)
+	if !ok {
+		return nil, fmt.Errorf("the vertex %s is unknown", req.ID)
+	}
+	return json.Marshal(GetVertexResponse{
+		Vertex: vtx,
+	})
+}
+
+// Issue leaves the transactions to Run when MaxOutstandingItems transactions are processing
+func (e *Engine) Issue(ctx context.Context, txs ...*Tx) error {
+	e.mu.Lock()
+	e.pending = append(e.pending, txs...)
+	e.mu.Unlock()
+	return e.issuePending(ctx)
+}
+
+func (e *Engine) Run(ctx context.Context) error {
+	var retryWait time.Duration
+	// repolledChits is the number of chits when the last repoll vertex was issued
+	repolledChits, repollWait := -1, time.Duration(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		if detached := e.dag.Detached(); len(detached) > 0 {
+			err := e.issue(ctx, detached)
+			if err != nil {
+				return errors.Wrap(err, "unable to reissue the transactions")
+			}
+		}
+		err := e.issuePending(ctx)
+		if err != nil {
+			return errors.Wrap(err, "unable to issue the pending transactions")
+		}
+		ids := e.next(e.dag.parameters.ConcurrentRepolls)
+		if len(ids) == 0 {
+			if e.dag.NumProcessing() == 0 && e.numPending() == 0 {
+				return nil
+			}
+			// every vertex has been polled but some conflicts are undecided, an empty vertex repolls the frontier
+			chits := e.dag.NumChits()
+			if chits != repolledChits {
+				repollWait = 0
+			} else {
+				repollWait, err = backoff(ctx, repollWait)
+				if err != nil {
+					return err
+				}
+			}
+			repolledChits = chits
+			err := e.issue(ctx, nil)
+			if err != nil {
+				return errors.Wrap(err, "unable to issue the repoll vertex")
+			}
+			continue
+		}
+		recorded, err := e.poll(ctx, ids)
+		if err != nil {
+			return err
+		}
+		if recorded > 0 {
+			retryWait = 0
+			continue
+		}
+		retryWait, err = backoff(ctx, retryWait)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func backoff(ctx context.Context, wait time.Duration) (time.Duration, error) {
+	wait *= 2
+	if wait < minRetryWait {
+		wait = minRetryWait
+	}
+	if wait > maxRetryWait {
+		wait = maxRetryWait
+	}
+	select {
+	case <-ctx.Done():
+		return wait, ctx.Err()
+	case <-time.After(wait):
+		return wait, nil
+	}
+}
+
+// poll returns the number of recorded polls, the vertices with less than k answers are polled again later
+func (e *Engine) poll(ctx context.Context, ids []string) (int, error) {
+	responses := make([]int, len(ids))
+	votes := make([]int, len(ids))
+	errs := make([]error, len(ids))
+	var wg sync.WaitGroup
+	for i, id := range ids {
+		wg.Add(1)
+		go func(i int, id string) {
+			defer wg.Done()
+			vtx, _ := e.dag.Get(id)
+			responses[i], votes[i], errs[i] = e.query(ctx, vtx)
+		}(i, id)
+	}
+	wg.Wait()
+	recorded := 0
+	for i, id := range ids {
+		if errs[i] != nil {
+			return recorded, errors.Wrap(errs[i], "unable to query the peers")
+		}
+		if responses[i] < e.dag.parameters.K {
+			e.enqueue(id)
+			continue
+		}
+		err := e.dag.RecordPoll(id, votes[i])
+		if err != nil {
+			return recorded, errors.Wrap(err, "unable to record the poll")
+		}
+		recorded++
+	}
+	return recorded, nil
+}
+
+func (e *Engine) issuePending(ctx context.Context) error {
+	e.mu.Lock()
+	available := e.dag.parameters.MaxOutstandingItems - e.dag.NumProcessing()
+	if available <= 0 || len(e.pending) == 0 {
+		e.mu.Unlock()
+		return nil
+	}
+	if available > len(e.pending) {
+		available = len(e.pending)
+	}
+	txs := e.pending[:available]
+	e.pending = e.pending[available:]
+	e.mu.Unlock()
+	return e.issue(ctx, txs)
+}
+
+func (e *Engine) numPending() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.pending)
+}
+
+func (e *Engine) issue(ctx context.Context, txs []*Tx) error {
+	vtx := NewVertex(e.dag.Frontier(), txs)
+	err := e.dag.Add(vtx)
+	if err != nil {
+		return errors.Wrap(err, "unable to add the issued vertex")
+	}
+	e.enqueue(vtx.ID)
+	// an empty vertex only repolls its ancestors, the sampled peers receive it with the query
+	if len(txs) == 0 {
+		return nil
+	}
+
+	peers, err := e.client.Peers()
+	if err != nil {
+		return errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	req := PushVertexRequest{
+		Vertex: vtx,
+	}
+	for _, peer := range peers {
+		if peer == nil || peer.Address == e.client.Peer().Address {
+			continue
+		}
+		err := e.client.Send(ctx, peer, "avalanche/push-vertex", req)
+		if err != nil {
+			log.Debugf("unable to push the vertex %s to %s: %v", vtx.ID, peer.Address, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) query(ctx context.Context, vtx *Vertex) (int, int, error) {
+	peers, err := e.client.Peers()
+	if err != nil {
+		return 0, 0, errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	req := PushVertexRequest{
+		Vertex: vtx,
+	}
+	var responses, votes int
+	// chits are 1 for a chit
+	var chits [][]byte
+	var weights []uint64
+	for _, i := range validators.SamplePeers(e.rand, peers) {
+		peer := peers[i]
+		if peer == nil {
+			continue
+		}
+		var resp PushQueryResponse
+		err := e.client.Request(ctx, peer, "avalanche/push-query", req, &resp)
+		if err != nil {
+			continue
+		}
+		responses++
+		chit := []byte{0}
+		if resp.Chit {
+			votes++
+			chit[0] = 1
+		}
+		chits = append(chits, chit)
+		weights = append(weights, peer.Weight)
+		if responses >= e.dag.parameters.K {
+			break
+		}
+	}
+	if e.dag.parameters.StakeAlpha {
+		votes = 0
+		for _, chit := range consensus.WeighPoll(chits, weights) {
+			if chit[0] == 1 {
+				votes++
+			}
+		}
+	}
+	return responses, votes, nil
+}
+
+func (e *Engine) receive(ctx context.Context, from string, vtx *Vertex) error {
+	if e.dag.Has(vtx.ID) {
+		return nil
+	}
+	fetched := map[string]bool{vtx.ID: true}
+	vertices := []*Vertex{vtx}
+	for i := 0; i < len(vertices); i++ {
+		for _, id := range e.dag.MissingParents(vertices[i]) {
+			if fetched[id] {
+				continue
+			}
+			if len(fetched) > maxMissingAncestors {
+				return fmt.Errorf("the vertex %s has more than %d missing ancestors", vtx.ID, maxMissingAncestors)
+			}
+			var resp GetVertexResponse
+			err := e.client.Request(ctx, &p2p.Peer{Address: from}, "avalanche/get-vertex", GetVertexRequest{ID: id}, &resp)
+			if err != nil {
+				return errors.Wrap(err, "unable to get the missing parent")
+			}
+			if resp.Vertex == nil || resp.Vertex.ID != id {
+				return errors.New("the peer returned another vertex")
+			}
+			fetched[id] = true
+			vertices = append(vertices, resp.Vertex)
+		}
+	}
+	// a verified vertex is higher than its parents, so they are added first
+	sort.SliceStable(vertices, func(i, j int) bool {
+		return vertices[i].Height < vertices[j].Height
+	})
+	for _, v := range vertices {
+		if e.dag.Has(v.ID) {
+			continue
+		}
+		err := e.dag.Add(v)
+		if err != nil {
+			return err
+		}
+		e.enqueue(v.ID)
+	}
+	return nil
+}
+
+func (e *Engine) enqueue(id string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.unpolled = append(e.unpolled, id)
+}
+
+func (e *Engine) next(n int) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	ids := make([]string, 0, n)
+	for len(e.unpolled) > 0 && len(ids) < n {
+		id := e.unpolled[0]
+		e.unpolled = e.unpolled[1:]
+		if e.dag.isProcessing(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,195 @@
+package avalanche
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+func startEngines(t *testing.T, ctx context.Context, parameters consensus.Parameters, numOfNodes int, seed int64) []*Engine {
+	t.Helper()
+	network := p2p.NewMemoryNetwork()
+	discovery := p2p.InitDiscovery(network.NewTransport("discovery"))
+	if err := discovery.Start(); err != nil {
+		t.Fatal(err)
+	}
+	engines := make([]*Engine, numOfNodes)
+	for j := range engines {
+		engine, err := NewEngine(parameters, seed+int64(j))
+		if err != nil {
+			t.Fatal(err)
+		}
+		client, err := p2p.InitClient(ctx, p2p.Config{
+			DiscoveryAddress: discovery.Address,
+			Transport:        network.NewTransport(fmt.Sprintf("node-%d", j)),
+		}, func(int) ([]byte, error) {
+			return nil, errors.New("the node has no block")
+		}, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		engine.SetClient(client)
+		engines[j] = engine
+	}
+	return engines
+}
+
+func TestEngineConflictingTransactionsConverge(t *testing.T) {
+	const (
+		numOfNodes = 10
+		numOfUTXOs = 3
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	engines := startEngines(t, ctx, consensus.Parameters{
+		K:                   5,
+		Alpha:               4,
+		BetaVirtuous:        5,
+		BetaRogue:           10,
+		ConcurrentRepolls:   2,
+		MaxOutstandingItems: 64,
+	}, numOfNodes, 1)
+
+	// every node spends one of the inputs, the nodes spending the same input conflict
+	for j, engine := range engines {
+		tx := NewTx([]string{fmt.Sprintf("utxo-%d", j%numOfUTXOs)}, []byte(fmt.Sprintf("node-%d", j)))
+		if err := engine.Issue(ctx, tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the conflicting transactions reach every node before the polls start
+	for _, engine := range engines {
+		for engine.DAG().NumProcessing() < numOfNodes {
+			select {
+			case <-ctx.Done():
+				t.Fatal("the transactions were not gossiped to every node")
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}
+
+	errs := make(chan error, numOfNodes)
+	for _, engine := range engines {
+		go func(engine *Engine) {
+			errs <- engine.Run(ctx)
+		}(engine)
+	}
+	for range engines {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for u := 0; u < numOfUTXOs; u++ {
+		input := fmt.Sprintf("utxo-%d", u)
+		accepted, ok := engines[0].DAG().AcceptedTx(input)
+		if !ok {
+			t.Fatalf("no transaction spending %s is accepted", input)
+		}
+		for j, engine := range engines[1:] {
+			tx, ok := engine.DAG().AcceptedTx(input)
+			if !ok || tx.ID != accepted.ID {
+				t.Errorf("node %d did not accept %s for %s", j+1, accepted.Data, input)
+			}
+		}
+	}
+}
+
+func TestEngineReceive(t *testing.T) {
+	tests := []struct {
+		name string
+		// ancestors is the number of vertices between the genesis and the pushed vertex
+		ancestors int
+		// spoofed is the sender the vertex is pushed from, the missing ancestors cannot be fetched from it
+		spoofed bool
+		added   bool
+	}{
+		{name: "the missing ancestors are fetched from the sender", ancestors: 3, added: true},
+		{name: "the ancestors are only fetched from the sender", ancestors: 3, spoofed: true},
+		{name: "the number of missing ancestors is bounded", ancestors: maxMissingAncestors + 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			engines := startEngines(t, ctx, consensus.Parameters{
+				K:                   1,
+				Alpha:               1,
+				BetaVirtuous:        1,
+				BetaRogue:           2,
+				ConcurrentRepolls:   1,
+				MaxOutstandingItems: 64,
+			}, 3, 1)
+			vertices := []*Vertex{Genesis()}
+			for i := 0; i <= tt.ancestors; i++ {
+				vtx := NewVertex(vertices[len(vertices)-1:], nil)
+				if i < tt.ancestors {
+					if err := engines[0].DAG().Add(vtx); err != nil {
+						t.Fatal(err)
+					}
+				}
+				vertices = append(vertices, vtx)
+			}
+			from := engines[0].client.Peer().Address
+			if tt.spoofed {
+				from = engines[2].client.Peer().Address
+			}
+			payload, err := json.Marshal(PushVertexRequest{Vertex: vertices[len(vertices)-1]})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = engines[1].PushVertex(ctx, from, payload)
+			if (err == nil) != tt.added {
+				t.Errorf("PushVertex() = %v, want added = %v", err, tt.added)
+			}
+			for _, vtx := range vertices[1:] {
+				if engines[1].DAG().Has(vtx.ID) != tt.added {
+					t.Errorf("the vertex at height %d is added = %v, want %v", vtx.Height, !tt.added, tt.added)
+				}
+			}
+		})
+	}
+}
+
+func TestEngineRepollsWithBackoff(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	engines := startEngines(t, ctx, consensus.Parameters{
+		K:                   5,
+		Alpha:               4,
+		BetaVirtuous:        5,
+		BetaRogue:           10,
+		ConcurrentRepolls:   2,
+		MaxOutstandingItems: 64,
+	}, 6, 1)
+	// the peers never vote for a vertex, the transaction cannot be accepted
+	for _, engine := range engines[1:] {
+		engine.SetResponder(func(string, bool) (bool, bool) {
+			return false, true
+		})
+	}
+	if err := engines[0].Issue(ctx, NewTx([]string{"x"}, []byte("tx"))); err != nil {
+		t.Fatal(err)
+	}
+	runCtx, cancelRun := context.WithTimeout(ctx, time.Second)
+	defer cancelRun()
+	if err := engines[0].Run(runCtx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Run() = %v, want the transaction to stay undecided", err)
+	}
+	dag := engines[0].DAG()
+	dag.mu.RLock()
+	defer dag.mu.RUnlock()
+	// the repolls wait 50ms, 100ms, 200ms, 400ms and 800ms
+	if n := len(dag.vertices); n > 10 {
+		t.Errorf("%d vertices were issued in a second, want the repolls to back off", n)
+	}
+}
@@ -0,0 +1,35 @@
+package avalanche
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Tx is a transaction spending a set of inputs, two transactions spending the same input conflict
+type Tx struct {
+	ID     string   `json:"id"`
+	Inputs []string `json:"inputs"`
+	Data   []byte   `json:"data"`
+}
+
+func NewTx(inputs []string, data []byte) *Tx {
+	tx := &Tx{
+		Inputs: inputs,
+		Data:   data,
+	}
+	tx.ID = tx.computeID()
+	return tx
+}
+
+func (t *Tx) computeID() string {
+	b, _ := json.Marshal(struct {
+		Inputs []string `json:"inputs"`
+		Data   []byte   `json:"data"`
+	}{
+		Inputs: t.Inputs,
+		Data:   t.Data,
+	})
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
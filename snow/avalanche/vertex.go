@@ -0,0 +1,83 @@
+package avalanche
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+)
+
+type Vertex struct {
+	ID        string   `json:"id"`
+	ParentIDs []string `json:"parentIds"`
+	Height    uint64   `json:"height"`
+	Txs       []*Tx    `json:"txs"`
+}
+
+// Genesis returns the vertex every DAG starts from, it is accepted by definition
+func Genesis() *Vertex {
+	return NewVertex(nil, nil)
+}
+
+func NewVertex(parents []*Vertex, txs []*Tx) *Vertex {
+	v := &Vertex{
+		ParentIDs: make([]string, 0, len(parents)),
+		Txs:       txs,
+	}
+	for _, parent := range parents {
+		v.ParentIDs = append(v.ParentIDs, parent.ID)
+		if parent.Height+1 > v.Height {
+			v.Height = parent.Height + 1
+		}
+	}
+	v.ID = v.computeID()
+	return v
+}
+
+func (v *Vertex) Verify(parents []*Vertex) error {
+	if v.ID != v.computeID() {
+		return errors.New("the vertex id does not match its content")
+	}
+	if len(parents) != len(v.ParentIDs) {
+		return fmt.Errorf("the vertex has %d parents, want %d", len(parents), len(v.ParentIDs))
+	}
+	var height uint64
+	for i, parent := range parents {
+		if parent.ID != v.ParentIDs[i] {
+			return fmt.Errorf("the parent %s is not the parent %s of the vertex", parent.ID, v.ParentIDs[i])
+		}
+		if parent.Height+1 > height {
+			height = parent.Height + 1
+		}
+	}
+	if len(parents) == 0 && len(v.Txs) > 0 {
+		return errors.New("the vertex has transactions but no parent")
+	}
+	if v.Height != height {
+		return fmt.Errorf("height = %d: fails the condition that: height = max(parent height) + 1 = %d", v.Height, height)
+	}
+	for _, tx := range v.Txs {
+		if tx == nil || tx.ID != tx.computeID() {
+			return errors.New("the transaction id does not match its content")
+		}
+		if len(tx.Inputs) == 0 {
+			return errors.New("the transaction has no input")
+		}
+	}
+	return nil
+}
+
+func (v *Vertex) computeID() string {
+	b, _ := json.Marshal(struct {
+		ParentIDs []string `json:"parentIds"`
+		Height    uint64   `json:"height"`
+		Txs       []*Tx    `json:"txs"`
+	}{
+		ParentIDs: v.ParentIDs,
+		Height:    v.Height,
+		Txs:       v.Txs,
+	})
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:])
+}
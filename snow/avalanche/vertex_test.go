@@ -0,0 +1,81 @@
+package avalanche
+
+import (
+	"testing"
+)
+
+func TestVertexVerify(t *testing.T) {
+	genesis := Genesis()
+	tx := NewTx([]string{"x"}, []byte("tx"))
+	child := NewVertex([]*Vertex{genesis}, []*Tx{tx})
+	tests := []struct {
+		name    string
+		vertex  func() *Vertex
+		parents []*Vertex
+		valid   bool
+	}{
+		{
+			name:   "the genesis",
+			vertex: Genesis,
+			valid:  true,
+		},
+		{
+			name: "a vertex on top of its parents",
+			vertex: func() *Vertex {
+				return NewVertex([]*Vertex{genesis, child}, []*Tx{NewTx([]string{"y"}, nil)})
+			},
+			parents: []*Vertex{genesis, child},
+			valid:   true,
+		},
+		{
+			name: "a vertex with transactions but no parent",
+			vertex: func() *Vertex {
+				return NewVertex(nil, []*Tx{tx})
+			},
+		},
+		{
+			name: "a vertex lower than its parents",
+			vertex: func() *Vertex {
+				v := NewVertex([]*Vertex{child}, nil)
+				v.Height = 1
+				v.ID = v.computeID()
+				return v
+			},
+			parents: []*Vertex{child},
+		},
+		{
+			name: "a vertex higher than its parents",
+			vertex: func() *Vertex {
+				v := NewVertex([]*Vertex{genesis}, nil)
+				v.Height = 5
+				v.ID = v.computeID()
+				return v
+			},
+			parents: []*Vertex{genesis},
+		},
+		{
+			name: "a vertex verified against other parents",
+			vertex: func() *Vertex {
+				return NewVertex([]*Vertex{genesis}, nil)
+			},
+			parents: []*Vertex{child},
+		},
+		{
+			name: "a vertex whose id does not match its content",
+			vertex: func() *Vertex {
+				v := NewVertex([]*Vertex{genesis}, nil)
+				v.Height = 2
+				return v
+			},
+			parents: []*Vertex{genesis},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.vertex().Verify(tt.parents)
+			if (err == nil) != tt.valid {
+				t.Errorf("Verify() = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
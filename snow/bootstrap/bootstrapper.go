@@ -0,0 +1,327 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"math/rand"
+	"sync"
+)
+
+var tracer = otel.Tracer("github.com/tiennampham23/avalanche-consensus-simulator/snow/bootstrap")
+
+// maxAncestors bounds the blocks of a single ancestors answer
+const maxAncestors = 256
+
+type BlockID struct {
+	Height uint64 `json:"height"`
+	Hash   string `json:"hash"`
+}
+
+type AcceptedFrontierResponse struct {
+	Frontier BlockID `json:"frontier"`
+}
+
+type AcceptedRequest struct {
+	Blocks []BlockID `json:"blocks"`
+}
+
+type AcceptedResponse struct {
+	Blocks []BlockID `json:"blocks"`
+}
+
+type AncestorsRequest struct {
+	Block BlockID `json:"block"`
+	Max   int     `json:"max"`
+}
+
+type AncestorsResponse struct {
+	// Blocks are from the highest to the lowest
+	Blocks []*chain.Block `json:"blocks"`
+}
+
+// Bootstrapper catches up with the accepted chain of the peers before the node joins the consensus
+type Bootstrapper struct {
+	parameters consensus.Parameters
+	client     *p2p.Client
+	state      *chain.BlockChainState
+	rand       *rand.Rand
+	mu         sync.Mutex
+}
+
+func NewBootstrapper(parameters consensus.Parameters, seed int64) (*Bootstrapper, error) {
+	err := parameters.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the consensus configuration")
+	}
+	return &Bootstrapper{
+		parameters: parameters,
+		rand:       random.New(seed),
+	}, nil
+}
+
+func (b *Bootstrapper) SetClient(client *p2p.Client) {
+	b.client = client
+}
+
+// SetChain may be called after the peers query the node
+func (b *Bootstrapper) SetChain(state *chain.BlockChainState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = state
+}
+
+func (b *Bootstrapper) Router(t p2p.Transport) {
+	t.Register("bootstrap/accepted-frontier", b.AcceptedFrontier)
+	t.Register("bootstrap/accepted", b.Accepted)
+	t.Register("bootstrap/ancestors", b.Ancestors)
+}
+
+func (b *Bootstrapper) AcceptedFrontier(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	state := b.chain()
+	if state == nil {
+		return nil, errors.New("the chain is not set")
+	}
+	tip := state.LastDecided()
+	if tip == nil {
+		return nil, errors.New("the chain has no decided block")
+	}
+	return json.Marshal(AcceptedFrontierResponse{
+		Frontier: BlockID{
+			Height: tip.Height,
+			Hash:   tip.BlockHash,
+		},
+	})
+}
+
+func (b *Bootstrapper) Accepted(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req AcceptedRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid accepted request")
+	}
+	accepted := make([]BlockID, 0, len(req.Blocks))
+	for _, id := range req.Blocks {
+		if b.isAccepted(id) {
+			accepted = append(accepted, id)
+		}
+	}
+	return json.Marshal(AcceptedResponse{
+		Blocks: accepted,
+	})
+}
+
+// Ancestors answers at most max-1 ancestors of the decided block
+func (b *Bootstrapper) Ancestors(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req AncestorsRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid ancestors request")
+	}
+	if !b.isAccepted(req.Block) {
+		return nil, fmt.Errorf("the block %s is not accepted", req.Block.Hash)
+	}
+	state := b.chain()
+	max := req.Max
+	if max <= 0 || max > maxAncestors {
+		max = maxAncestors
+	}
+	blocks := make([]*chain.Block, 0, max)
+	for height := int64(req.Block.Height); height >= 0 && len(blocks) < max; height-- {
+		block, ok := state.Block(uint64(height))
+		if !ok {
+			break
+		}
+		blocks = append(blocks, block)
+	}
+	return json.Marshal(AncestorsResponse{
+		Blocks: blocks,
+	})
+}
+
+// Bootstrap does nothing when less than alpha peers answer or the chain has undecided blocks, the consensus catches up then
+func (b *Bootstrapper) Bootstrap(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "Bootstrapper.Bootstrap", trace.WithAttributes(
+		attribute.String("node.address", b.client.Transport().Address()),
+	))
+	defer span.End()
+	tip := b.state.LastBlock()
+	if tip != nil && !b.state.Decided(int(tip.Height)) {
+		return nil
+	}
+	start := nextHeight(tip)
+	defer func() {
+		span.SetAttributes(attribute.Int64("chain.bootstrapped", int64(nextHeight(b.state.LastBlock())-start)))
+	}()
+	for {
+		peers, err := b.sample()
+		if err != nil {
+			return err
+		}
+		frontier, holders := b.frontier(ctx, peers)
+		if len(holders) == 0 || frontier.Height < nextHeight(tip) {
+			return nil
+		}
+		blocks, err := b.fetch(ctx, frontier, tip, holders)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to fetch the ancestors of the block %s", frontier.Hash))
+		}
+		for _, block := range blocks {
+			err = b.state.Add(block)
+			if err != nil {
+				return err
+			}
+			err = b.state.Decide(int(block.Height))
+			if err != nil {
+				return err
+			}
+		}
+		log.Infof("node: %s bootstrapped the heights %d to %d", b.client.Peer().Address, blocks[0].Height, frontier.Height)
+		tip = b.state.LastBlock()
+	}
+}
+
+func (b *Bootstrapper) sample() ([]*p2p.Peer, error) {
+	peers, err := b.client.Peers()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	sampled := make([]*p2p.Peer, 0, b.parameters.K)
+	for _, i := range b.rand.Perm(len(peers)) {
+		peer := peers[i]
+		if peer == nil || peer.Address == b.client.Peer().Address {
+			continue
+		}
+		sampled = append(sampled, peer)
+		if len(sampled) >= b.parameters.K {
+			break
+		}
+	}
+	return sampled, nil
+}
+
+// frontier returns the highest block accepted by at least alpha peers, there are no peers if none is
+func (b *Bootstrapper) frontier(ctx context.Context, peers []*p2p.Peer) (BlockID, []*p2p.Peer) {
+	seen := make(map[string]bool)
+	var frontiers []BlockID
+	for _, peer := range peers {
+		var resp AcceptedFrontierResponse
+		err := b.client.Request(ctx, peer, "bootstrap/accepted-frontier", nil, &resp)
+		if err != nil {
+			log.Debugf("unable to get the accepted frontier of %s: %v", peer.Address, err)
+			continue
+		}
+		if !seen[resp.Frontier.Hash] {
+			seen[resp.Frontier.Hash] = true
+			frontiers = append(frontiers, resp.Frontier)
+		}
+	}
+	if len(frontiers) == 0 {
+		return BlockID{}, nil
+	}
+	holders := make(map[string][]*p2p.Peer)
+	for _, peer := range peers {
+		var resp AcceptedResponse
+		err := b.client.Request(ctx, peer, "bootstrap/accepted", AcceptedRequest{Blocks: frontiers}, &resp)
+		if err != nil {
+			log.Debugf("unable to get the accepted blocks of %s: %v", peer.Address, err)
+			continue
+		}
+		for _, id := range resp.Blocks {
+			if seen[id.Hash] {
+				holders[id.Hash] = append(holders[id.Hash], peer)
+			}
+		}
+	}
+	var best BlockID
+	var bestHolders []*p2p.Peer
+	for _, id := range frontiers {
+		if len(holders[id.Hash]) < b.parameters.Alpha {
+			continue
+		}
+		if bestHolders == nil || id.Height > best.Height {
+			best = id
+			bestHolders = holders[id.Hash]
+		}
+	}
+	return best, bestHolders
+}
+
+// fetch returns the blocks from the lowest to the highest, every block must have the height and the hash its child links to
+func (b *Bootstrapper) fetch(ctx context.Context, frontier BlockID, tip *chain.Block, peers []*p2p.Peer) ([]*chain.Block, error) {
+	// the first block has no parent
+	base := BlockID{Height: nextHeight(tip)}
+	if tip != nil {
+		base.Hash = tip.BlockHash
+	}
+	blocks := make([]*chain.Block, frontier.Height-base.Height+1)
+	next := frontier
+	done := false
+	for !done {
+		var resp AncestorsResponse
+		var err error
+		for _, i := range b.rand.Perm(len(peers)) {
+			resp = AncestorsResponse{}
+			err = b.client.Request(ctx, peers[i], "bootstrap/ancestors", AncestorsRequest{
+				Block: next,
+				Max:   int(next.Height - base.Height + 1),
+			}, &resp)
+			if err == nil && len(resp.Blocks) > 0 {
+				break
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Blocks) == 0 {
+			return nil, errors.New("the peers answered no block")
+		}
+		for _, block := range resp.Blocks {
+			if block == nil || block.Height != next.Height || block.BlockHash != next.Hash || block.Hash() != block.BlockHash {
+				return nil, fmt.Errorf("the peers answered another block than the block %s at the height %d", next.Hash, next.Height)
+			}
+			blocks[block.Height-base.Height] = block
+			if block.Height == base.Height {
+				done = true
+				if block.ParentHash != base.Hash {
+					return nil, fmt.Errorf("the parent of the block at the height %d is %q for the peers, it conflicts with the last block %q of the chain", block.Height, block.ParentHash, base.Hash)
+				}
+				break
+			}
+			next = BlockID{
+				Height: block.Height - 1,
+				Hash:   block.ParentHash,
+			}
+		}
+	}
+	return blocks, nil
+}
+
+func (b *Bootstrapper) isAccepted(id BlockID) bool {
+	state := b.chain()
+	if state == nil {
+		return false
+	}
+	block, ok := state.Block(id.Height)
+	return ok && block.BlockHash == id.Hash && state.Decided(int(id.Height))
+}
+
+func nextHeight(tip *chain.Block) uint64 {
+	if tip == nil {
+		return 0
+	}
+	return tip.Height + 1
+}
+
+func (b *Bootstrapper) chain() *chain.BlockChainState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,180 @@
+package bootstrap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+var testParameters = consensus.Parameters{
+	K:                   3,
+	Alpha:               2,
+	BetaVirtuous:        1,
+	BetaRogue:           2,
+	ConcurrentRepolls:   1,
+	MaxOutstandingItems: 1,
+}
+
+// forgingRouter lets forge tamper with the answered ancestors
+type forgingRouter struct {
+	*Bootstrapper
+	forge func(resp *AncestorsResponse)
+}
+
+func (r *forgingRouter) Router(t p2p.Transport) {
+	t.Register("bootstrap/accepted-frontier", r.AcceptedFrontier)
+	t.Register("bootstrap/accepted", r.Accepted)
+	t.Register("bootstrap/ancestors", func(ctx context.Context, from string, payload []byte) ([]byte, error) {
+		answer, err := r.Ancestors(ctx, from, payload)
+		if err != nil || r.forge == nil {
+			return answer, err
+		}
+		var resp AncestorsResponse
+		if err := json.Unmarshal(answer, &resp); err != nil {
+			return nil, err
+		}
+		r.forge(&resp)
+		return json.Marshal(resp)
+	})
+}
+
+func startBootstrapper(t *testing.T, ctx context.Context, network *p2p.MemoryNetwork, discovery *p2p.Discovery, j int, blocks []*chain.Block, forge func(*AncestorsResponse)) *Bootstrapper {
+	t.Helper()
+	b, err := NewBootstrapper(testParameters, int64(j+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := chain.InitBlockChainState()
+	for _, block := range blocks {
+		if err := state.Add(block); err != nil {
+			t.Fatal(err)
+		}
+		if err := state.Decide(int(block.Height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.SetChain(state)
+	client, err := p2p.InitClient(ctx, p2p.Config{
+		DiscoveryAddress: discovery.Address,
+		Transport:        network.NewTransport(fmt.Sprintf("node-%d", j)),
+	}, func(int) ([]byte, error) {
+		return nil, errors.New("the node serves no block data")
+	}, &forgingRouter{Bootstrapper: b, forge: forge})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+	b.SetClient(client)
+	return b
+}
+
+func TestBootstrap(t *testing.T) {
+	newChain := func(genesis string) []*chain.Block {
+		blocks := []*chain.Block{chain.NewBlock(nil, []byte(genesis), 0)}
+		for i := 1; i <= 5; i++ {
+			blocks = append(blocks, chain.NewBlock(blocks[i-1], []byte(fmt.Sprintf("block-%d", i)), 0))
+		}
+		return blocks
+	}
+	blocks := newChain("genesis")
+	tests := []struct {
+		name string
+		// known are the blocks the bootstrapping node starts with
+		known int
+		forge func(resp *AncestorsResponse)
+		// conflicting peers accepted a chain with another genesis block
+		conflicting bool
+		// a failed bootstrap leaves the chain as it was
+		bootstrapped bool
+	}{
+		{
+			name:         "the blocks after the genesis are bootstrapped",
+			known:        1,
+			bootstrapped: true,
+		},
+		{
+			name:         "an empty chain bootstraps its first block",
+			known:        0,
+			bootstrapped: true,
+		},
+		{
+			name:  "an ancestor whose content does not match its hash is rejected",
+			known: 1,
+			forge: func(resp *AncestorsResponse) {
+				resp.Blocks[2].Data = []byte("forged")
+			},
+		},
+		{
+			name:  "a rehashed ancestor the child does not link to is rejected",
+			known: 1,
+			forge: func(resp *AncestorsResponse) {
+				forged := *resp.Blocks[2]
+				forged.Data = []byte("forged")
+				forged.BlockHash = forged.Hash()
+				resp.Blocks[2] = &forged
+			},
+		},
+		{
+			name:  "a missing ancestor is rejected",
+			known: 1,
+			forge: func(resp *AncestorsResponse) {
+				resp.Blocks = append(resp.Blocks[:2], resp.Blocks[3:]...)
+			},
+		},
+		{
+			name:        "a chain that conflicts with the last block of the chain is rejected",
+			known:       1,
+			conflicting: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			network := p2p.NewMemoryNetwork()
+			discovery := p2p.InitDiscovery(network.NewTransport("discovery"))
+			if err := discovery.Start(); err != nil {
+				t.Fatal(err)
+			}
+			accepted := blocks
+			if tt.conflicting {
+				accepted = newChain("another genesis")
+			}
+			for j := 1; j <= testParameters.K; j++ {
+				startBootstrapper(t, ctx, network, discovery, j, accepted, tt.forge)
+			}
+			b := startBootstrapper(t, ctx, network, discovery, 0, blocks[:tt.known], nil)
+
+			err := b.Bootstrap(ctx)
+			want := blocks[:tt.known]
+			if tt.bootstrapped {
+				if err != nil {
+					t.Fatal(err)
+				}
+				want = blocks
+			} else if err == nil {
+				t.Fatal("the forged ancestors are bootstrapped")
+			}
+			if len(b.state.Blocks) != len(want) {
+				t.Fatalf("the chain has %d blocks, want %d", len(b.state.Blocks), len(want))
+			}
+			for i, block := range want {
+				if b.state.Blocks[i].BlockHash != block.BlockHash {
+					t.Errorf("the block at the height %d is %s, want %s", i, b.state.Blocks[i].BlockHash, block.BlockHash)
+				}
+				if !b.state.Decided(i) {
+					t.Errorf("the block at the height %d is not decided", i)
+				}
+			}
+		})
+	}
+}
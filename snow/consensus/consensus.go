@@ -0,0 +1,218 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"math/bits"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	minRetryWait = 50 * time.Millisecond
+	maxRetryWait = 2 * time.Second
+)
+
+var tracer = otel.Tracer("github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus")
+
+// Consensus is a single decision that is made by repeatedly polling k random peers
+type Consensus interface {
+	Parameters() Parameters
+	RecordPoll(preferences [][]byte) error
+	Preference() []byte
+	Finalized() bool
+}
+
+// NewConsensus takes the parent only for Snowman, it may be nil
+func NewConsensus(parameters Parameters, preference []byte, parent Consensus) (Consensus, error) {
+	err := parameters.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the consensus configuration")
+	}
+
+	switch parameters.Algorithm {
+	case SlushAlgorithm:
+		return newSlush(parameters, preference), nil
+	case SnowflakeAlgorithm:
+		return newSnowflake(parameters, preference), nil
+	case SnowmanAlgorithm:
+		return newSnowman(parameters, preference, parent), nil
+	case SnowballTreeAlgorithm:
+		return newTree(parameters, preference), nil
+	default:
+		return newSnowball(parameters, preference), nil
+	}
+}
+
+// Sync synchronize data between the peers
+//
+// Ref: https://github.com/ava-labs/mastering-avalanche/blob/main/chapter_09.md
+func Sync(ctx context.Context, c Consensus, setNewBlockDataFunc func([]byte) error, getBlockDataFromRandomKFunc func(context.Context, int) ([][]byte, error)) error {
+	parameters := c.Parameters()
+	ctx, span := tracer.Start(ctx, "consensus.Sync", trace.WithAttributes(
+		attribute.String("consensus.algorithm", string(parameters.Algorithm)),
+		attribute.Int("consensus.k", parameters.K),
+		attribute.Int("consensus.alpha", parameters.Alpha),
+	))
+	defer span.End()
+	rounds := 0
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("consensus.rounds", rounds),
+			attribute.Bool("consensus.finalized", c.Finalized()),
+		)
+	}()
+	var retryWait time.Duration
+	for !c.Finalized() {
+		rounds++
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+		// ask k random peers to get the preferences
+		polls := make([][][]byte, parameters.Repolls())
+		errs := make([]error, parameters.Repolls())
+		var wg sync.WaitGroup
+		for i := range polls {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				polls[i], errs[i] = getBlockDataFromRandomKFunc(ctx, parameters.K)
+			}(i)
+		}
+		wg.Wait()
+		oldPreference := c.Preference()
+		recorded := 0
+		for i, preferenceFromK := range polls {
+			if errs[i] != nil {
+				span.RecordError(errs[i])
+				span.SetStatus(codes.Error, "unable to poll the peers")
+				return errors.Wrap(errs[i], "unable to get get block data from cb function")
+			}
+			if len(preferenceFromK) < parameters.K || c.Finalized() {
+				continue
+			}
+			err := c.RecordPoll(preferenceFromK)
+			if err != nil {
+				return errors.Wrap(err, "unable to record the poll")
+			}
+			recorded++
+		}
+		if recorded > 0 {
+			retryWait = 0
+		} else if !c.Finalized() {
+			retryWait *= 2
+			if retryWait < minRetryWait {
+				retryWait = minRetryWait
+			}
+			if retryWait > maxRetryWait {
+				retryWait = maxRetryWait
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(retryWait):
+			}
+		}
+		if bytes.Equal(oldPreference, c.Preference()) {
+			continue
+		}
+		span.AddEvent("the preference flipped", trace.WithAttributes(attribute.Int("consensus.round", rounds)))
+		// set the current data block to the new preference
+		err := setNewBlockDataFunc(c.Preference())
+		if err != nil {
+			return errors.Wrap(err, "unable to update the preference")
+		}
+	}
+	return nil
+}
+
+// GetMostFrequentPreference breaks a tie with the first preference
+func GetMostFrequentPreference(preferences [][]byte) (int, []byte, error) {
+	if len(preferences) == 0 {
+		return 0, nil, errors.New("the preferences is empty")
+	}
+	counts := make(map[string]int, len(preferences))
+	for _, preference := range preferences {
+		counts[string(preference)]++
+	}
+	var count int
+	var preference []byte
+	for _, p := range preferences {
+		if c := counts[string(p)]; c > count {
+			count = c
+			preference = p
+		}
+	}
+	return count, preference, nil
+}
+
+// WeighPoll shares the votes of the poll by the largest remainder method, the poll is unchanged when it has no stake
+func WeighPoll(preferences [][]byte, weights []uint64) [][]byte {
+	// the weights are halved until the stake of the poll fits in 64 bits
+	shift := uint(0)
+	for overflows(weights[:len(preferences)], shift) {
+		shift++
+	}
+	var choices [][]byte
+	stakes := make(map[string]uint64)
+	var total uint64
+	for i, preference := range preferences {
+		key := string(preference)
+		if _, ok := stakes[key]; !ok {
+			choices = append(choices, preference)
+		}
+		stakes[key] += weights[i] >> shift
+		total += weights[i] >> shift
+	}
+	if total == 0 {
+		return preferences
+	}
+	votes := make([]int, len(choices))
+	remainders := make([]uint64, len(choices))
+	given := 0
+	for i, choice := range choices {
+		// votes = len(preferences) * stake / total, without overflowing
+		hi, lo := bits.Mul64(uint64(len(preferences)), stakes[string(choice)])
+		quotient, remainder := bits.Div64(hi, lo, total)
+		votes[i] = int(quotient)
+		remainders[i] = remainder
+		given += votes[i]
+	}
+	// the votes left go to the largest remainders, the first choice in the poll wins a tie
+	order := make([]int, len(choices))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+	for _, i := range order[:len(preferences)-given] {
+		votes[i]++
+	}
+	weighed := make([][]byte, 0, len(preferences))
+	for i, choice := range choices {
+		for v := 0; v < votes[i]; v++ {
+			weighed = append(weighed, choice)
+		}
+	}
+	return weighed
+}
+
+func overflows(weights []uint64, shift uint) bool {
+	var total, carry uint64
+	for _, w := range weights {
+		total, carry = bits.Add64(total, w>>shift, 0)
+		if carry != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,269 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var testParameters = Parameters{
+	K:                   5,
+	Alpha:               3,
+	BetaVirtuous:        2,
+	BetaRogue:           3,
+	ConcurrentRepolls:   1,
+	MaxOutstandingItems: 1,
+	Rounds:              3,
+}
+
+// poll returns k votes, the first one of the choices gets the number of votes and the next one the others
+func poll(votes int, choice, other string) [][]byte {
+	preferences := make([][]byte, 0, testParameters.K)
+	for i := 0; i < testParameters.K; i++ {
+		if i < votes {
+			preferences = append(preferences, []byte(choice))
+		} else {
+			preferences = append(preferences, []byte(other))
+		}
+	}
+	return preferences
+}
+
+func TestNewConsensus(t *testing.T) {
+	tests := []struct {
+		algorithm Algorithm
+		want      string
+	}{
+		{algorithm: "", want: "*consensus.snowball"},
+		{algorithm: SlushAlgorithm, want: "*consensus.slush"},
+		{algorithm: SnowflakeAlgorithm, want: "*consensus.snowflake"},
+		{algorithm: SnowballAlgorithm, want: "*consensus.snowball"},
+		{algorithm: SnowmanAlgorithm, want: "*consensus.snowman"},
+		{algorithm: SnowballTreeAlgorithm, want: "*consensus.tree"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.algorithm), func(t *testing.T) {
+			parameters := testParameters
+			parameters.Algorithm = tt.algorithm
+			c, err := NewConsensus(parameters, []byte("a"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := fmt.Sprintf("%T", c); got != tt.want {
+				t.Errorf("the consensus is a %s, want %s", got, tt.want)
+			}
+		})
+	}
+	parameters := testParameters
+	parameters.Algorithm = "avalanche"
+	if _, err := NewConsensus(parameters, []byte("a"), nil); err == nil {
+		t.Error("an unknown algorithm is accepted")
+	}
+}
+
+func TestSlush(t *testing.T) {
+	tests := []struct {
+		name       string
+		polls      [][][]byte
+		preference string
+		finalized  bool
+	}{
+		{
+			name:       "the preference follows the α-majority of every poll",
+			polls:      [][][]byte{poll(3, "b", "a"), poll(4, "a", "b")},
+			preference: "a",
+		},
+		{
+			name:       "a poll without α-majority keeps the preference",
+			polls:      [][][]byte{poll(3, "b", "a"), poll(2, "a", "b")},
+			preference: "b",
+		},
+		{
+			name:       "slush terminates after m rounds even without a majority",
+			polls:      [][][]byte{poll(2, "b", "a"), poll(2, "b", "a"), poll(2, "b", "a")},
+			preference: "a",
+			finalized:  true,
+		},
+		{
+			name:       "the polls after m rounds are ignored",
+			polls:      [][][]byte{poll(5, "a", "b"), poll(5, "a", "b"), poll(5, "a", "b"), poll(5, "b", "a")},
+			preference: "a",
+			finalized:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSlush(testParameters, []byte("a"))
+			for _, preferences := range tt.polls {
+				if err := s.RecordPoll(preferences); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(s.Preference(), []byte(tt.preference)) {
+				t.Errorf("preference = %s, want %s", s.Preference(), tt.preference)
+			}
+			if s.Finalized() != tt.finalized {
+				t.Errorf("finalized = %v, want %v", s.Finalized(), tt.finalized)
+			}
+		})
+	}
+}
+
+func TestSnowflake(t *testing.T) {
+	tests := []struct {
+		name       string
+		polls      [][][]byte
+		preference string
+		confidence int
+		finalized  bool
+	}{
+		{
+			name:       "BetaVirtuous polls without a conflict finalize",
+			polls:      [][][]byte{poll(5, "a", "a"), poll(5, "a", "a")},
+			preference: "a",
+			confidence: 2,
+			finalized:  true,
+		},
+		{
+			name:       "a conflicting vote needs BetaRogue polls",
+			polls:      [][][]byte{poll(4, "a", "b"), poll(5, "a", "a")},
+			preference: "a",
+			confidence: 2,
+		},
+		{
+			name:       "a change of the preference resets the confidence",
+			polls:      [][][]byte{poll(4, "a", "b"), poll(4, "a", "b"), poll(3, "b", "a")},
+			preference: "b",
+			confidence: 1,
+		},
+		{
+			name:       "a poll without α-majority resets the confidence",
+			polls:      [][][]byte{poll(4, "a", "b"), poll(4, "a", "b"), poll(2, "a", "b"), poll(4, "a", "b")},
+			preference: "a",
+			confidence: 1,
+		},
+		{
+			name:       "BetaRogue consecutive polls finalize a rogue decision",
+			polls:      [][][]byte{poll(3, "b", "a"), poll(4, "b", "a"), poll(5, "b", "b")},
+			preference: "b",
+			confidence: 3,
+			finalized:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSnowflake(testParameters, []byte("a"))
+			for _, preferences := range tt.polls {
+				if err := s.RecordPoll(preferences); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(s.Preference(), []byte(tt.preference)) {
+				t.Errorf("preference = %s, want %s", s.Preference(), tt.preference)
+			}
+			if s.Confidence() != tt.confidence {
+				t.Errorf("confidence = %d, want %d", s.Confidence(), tt.confidence)
+			}
+			if s.Finalized() != tt.finalized {
+				t.Errorf("finalized = %v, want %v", s.Finalized(), tt.finalized)
+			}
+		})
+	}
+}
+
+func TestSnowman(t *testing.T) {
+	tests := []struct {
+		name string
+		// parentPolls are the polls of the parent, the parent is nil when it is negative
+		parentPolls int
+		finalized   bool
+	}{
+		{name: "a block without a parent finalizes on its own", parentPolls: -1, finalized: true},
+		{name: "a block is not final before its parent", parentPolls: 1, finalized: false},
+		{name: "a block is final once its parent is", parentPolls: 2, finalized: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parent Consensus
+			if tt.parentPolls >= 0 {
+				p := newSnowman(testParameters, []byte("a"), nil)
+				for i := 0; i < tt.parentPolls; i++ {
+					if err := p.RecordPoll(poll(5, "a", "a")); err != nil {
+						t.Fatal(err)
+					}
+				}
+				parent = p
+			}
+			s := newSnowman(testParameters, []byte("b"), parent)
+			for i := 0; i < testParameters.BetaVirtuous; i++ {
+				if err := s.RecordPoll(poll(5, "b", "b")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if s.Finalized() != tt.finalized {
+				t.Errorf("finalized = %v, want %v", s.Finalized(), tt.finalized)
+			}
+		})
+	}
+}
+
+func TestSyncBacksOffWithoutEnoughAnswers(t *testing.T) {
+	parameters := testParameters
+	parameters.Algorithm = SlushAlgorithm
+	c, err := NewConsensus(parameters, []byte("a"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 400*time.Millisecond)
+	defer cancel()
+	polls := 0
+	err = Sync(ctx, c, func([]byte) error {
+		return nil
+	}, func(context.Context, int) ([][]byte, error) {
+		polls++
+		return poll(1, "a", "b")[:1], nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Sync() = %v, want the decision to stay open", err)
+	}
+	// the rounds wait 50ms, 100ms and 200ms
+	if polls > 4 {
+		t.Errorf("%d polls were issued, want the rounds to back off", polls)
+	}
+}
+
+func TestWeighPoll(t *testing.T) {
+	const max = ^uint64(0)
+	tests := []struct {
+		name    string
+		weights []uint64
+		// votes are the votes of a once the poll is weighed, b gets the others
+		votes int
+	}{
+		{name: "the same stakes keep the votes", weights: []uint64{1, 1, 1, 1, 1}, votes: 3},
+		{name: "a large stake outweighs the others", weights: []uint64{100, 0, 0, 1, 1}, votes: 5},
+		{name: "the huge stakes of a do not overflow", weights: []uint64{max, max, max, 1, 1}, votes: 5},
+		{name: "the huge stakes of b do not overflow", weights: []uint64{1, 1, 1, max, max}, votes: 0},
+		{name: "the huge stakes are shared in proportion", weights: []uint64{max, max, max, max, max}, votes: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weighed := WeighPoll(poll(3, "a", "b"), tt.weights)
+			if len(weighed) != testParameters.K {
+				t.Fatalf("the weighed poll has %d votes, want %d", len(weighed), testParameters.K)
+			}
+			votes := 0
+			for _, preference := range weighed {
+				if bytes.Equal(preference, []byte("a")) {
+					votes++
+				}
+			}
+			if votes != tt.votes {
+				t.Errorf("a gets %d votes, want %d", votes, tt.votes)
+			}
+		})
+	}
+}
@@ -2,10 +2,31 @@ package consensus
 
 import "fmt"
 
+type Algorithm string
+
+const (
+	SlushAlgorithm     Algorithm = "slush"
+	SnowflakeAlgorithm Algorithm = "snowflake"
+	SnowballAlgorithm  Algorithm = "snowball"
+	SnowmanAlgorithm   Algorithm = "snowman"
+	// SnowballTreeAlgorithm runs Snowball bit by bit on the hashes of the choices
+	SnowballTreeAlgorithm Algorithm = "snowball-tree"
+)
+
 type Parameters struct {
-	K     int
-	Alpha int
-	Beta  int
+	// Snowball is used when Algorithm is empty
+	Algorithm Algorithm `json:"algorithm" yaml:"algorithm" toml:"algorithm"`
+	K         int       `json:"k" yaml:"k" toml:"k"`
+	Alpha     int       `json:"alpha" yaml:"alpha" toml:"alpha"`
+	// BetaVirtuous finalizes a decision without conflicts, BetaRogue one with conflicts
+	BetaVirtuous        int `json:"beta_virtuous" yaml:"beta_virtuous" toml:"beta_virtuous"`
+	BetaRogue           int `json:"beta_rogue" yaml:"beta_rogue" toml:"beta_rogue"`
+	ConcurrentRepolls   int `json:"concurrent_repolls" yaml:"concurrent_repolls" toml:"concurrent_repolls"`
+	MaxOutstandingItems int `json:"max_outstanding_items" yaml:"max_outstanding_items" toml:"max_outstanding_items"`
+	// Rounds is m, the number of rounds of Slush
+	Rounds int `json:"rounds" yaml:"rounds" toml:"rounds"`
+	// with StakeAlpha, alpha is a share alpha/k of the stake of the poll
+	StakeAlpha bool `json:"stake_alpha" yaml:"stake_alpha" toml:"stake_alpha"`
 }
 
 // Verify returns nil if the parameters describe a valid initialization.
@@ -15,7 +36,42 @@ func (p *Parameters) Verify() error {
 		return fmt.Errorf("k = %d, alpha = %d: fails the condition that: k/2 < alpha", p.K, p.Alpha)
 	case p.K < p.Alpha:
 		return fmt.Errorf("k = %d, alpha = %d: fails the condition that: alpha <= k", p.K, p.Alpha)
-	default:
+	case p.MaxOutstandingItems <= 0:
+		return fmt.Errorf("maxOutstandingItems = %d: fails the condition that: 0 < maxOutstandingItems", p.MaxOutstandingItems)
+	}
+	switch p.Algorithm {
+	case SlushAlgorithm:
+		if p.Rounds <= 0 {
+			return fmt.Errorf("rounds = %d: fails the condition that: 0 < rounds", p.Rounds)
+		}
+		if p.ConcurrentRepolls < 0 {
+			return fmt.Errorf("concurrentRepolls = %d: fails the condition that: 0 <= concurrentRepolls", p.ConcurrentRepolls)
+		}
 		return nil
+	case "", SnowflakeAlgorithm, SnowballAlgorithm, SnowmanAlgorithm, SnowballTreeAlgorithm:
+		return p.verifyBetas()
+	default:
+		return fmt.Errorf("algorithm = %s: is not supported", p.Algorithm)
+	}
+}
+
+func (p *Parameters) verifyBetas() error {
+	switch {
+	case p.BetaVirtuous <= 0:
+		return fmt.Errorf("betaVirtuous = %d: fails the condition that: 0 < betaVirtuous", p.BetaVirtuous)
+	case p.BetaRogue < p.BetaVirtuous:
+		return fmt.Errorf("betaVirtuous = %d, betaRogue = %d: fails the condition that: betaVirtuous <= betaRogue", p.BetaVirtuous, p.BetaRogue)
+	case p.ConcurrentRepolls <= 0:
+		return fmt.Errorf("concurrentRepolls = %d: fails the condition that: 0 < concurrentRepolls", p.ConcurrentRepolls)
+	case p.ConcurrentRepolls > p.BetaRogue:
+		return fmt.Errorf("concurrentRepolls = %d, betaRogue = %d: fails the condition that: concurrentRepolls <= betaRogue", p.ConcurrentRepolls, p.BetaRogue)
+	}
+	return nil
+}
+
+func (p *Parameters) Repolls() int {
+	if p.ConcurrentRepolls <= 0 {
+		return 1
 	}
+	return p.ConcurrentRepolls
 }
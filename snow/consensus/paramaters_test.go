@@ -0,0 +1,56 @@
+package consensus
+
+import (
+	"testing"
+)
+
+func TestParametersVerify(t *testing.T) {
+	tests := []struct {
+		name       string
+		parameters Parameters
+		valid      bool
+	}{
+		{
+			name:       "slush only needs the rounds",
+			parameters: Parameters{Algorithm: SlushAlgorithm, K: 5, Alpha: 3, MaxOutstandingItems: 1, Rounds: 3},
+			valid:      true,
+		},
+		{
+			name:       "slush without rounds",
+			parameters: Parameters{Algorithm: SlushAlgorithm, K: 5, Alpha: 3, MaxOutstandingItems: 1},
+		},
+		{
+			name:       "snowball needs the betas",
+			parameters: Parameters{Algorithm: SnowballAlgorithm, K: 5, Alpha: 3, MaxOutstandingItems: 1, ConcurrentRepolls: 1},
+		},
+		{
+			name:       "snowflake needs the concurrent repolls",
+			parameters: Parameters{Algorithm: SnowflakeAlgorithm, K: 5, Alpha: 3, MaxOutstandingItems: 1, BetaVirtuous: 2, BetaRogue: 3},
+		},
+		{
+			name:       "snowman with a rogue beta lower than the virtuous one",
+			parameters: Parameters{Algorithm: SnowmanAlgorithm, K: 5, Alpha: 3, MaxOutstandingItems: 1, BetaVirtuous: 3, BetaRogue: 2, ConcurrentRepolls: 1},
+		},
+		{
+			name:       "the default algorithm",
+			parameters: Parameters{K: 5, Alpha: 3, MaxOutstandingItems: 1, BetaVirtuous: 2, BetaRogue: 3, ConcurrentRepolls: 1},
+			valid:      true,
+		},
+		{
+			name:       "alpha is not a majority",
+			parameters: Parameters{Algorithm: SlushAlgorithm, K: 5, Alpha: 2, MaxOutstandingItems: 1, Rounds: 3},
+		},
+		{
+			name:       "an unknown algorithm",
+			parameters: Parameters{Algorithm: "avalanche", K: 5, Alpha: 3, MaxOutstandingItems: 1, BetaVirtuous: 2, BetaRogue: 3, ConcurrentRepolls: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.parameters.Verify()
+			if (err == nil) != tt.valid {
+				t.Errorf("Verify() = %v, want valid = %v", err, tt.valid)
+			}
+		})
+	}
+}
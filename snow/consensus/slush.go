@@ -0,0 +1,44 @@
+package consensus
+
+import "github.com/pkg/errors"
+
+// slush adopts the α-majority of every poll and terminates after a fixed number of rounds
+type slush struct {
+	parameters Parameters
+	preference []byte
+	rounds     int
+}
+
+func newSlush(parameters Parameters, preference []byte) *slush {
+	return &slush{
+		parameters: parameters,
+		preference: preference,
+	}
+}
+
+func (s *slush) Parameters() Parameters {
+	return s.parameters
+}
+
+func (s *slush) RecordPoll(preferences [][]byte) error {
+	if s.Finalized() {
+		return nil
+	}
+	frequent, preference, err := GetMostFrequentPreference(preferences)
+	if err != nil {
+		return errors.Wrap(err, "unable to get the most frequent")
+	}
+	s.rounds++
+	if frequent >= s.parameters.Alpha {
+		s.preference = preference
+	}
+	return nil
+}
+
+func (s *slush) Preference() []byte {
+	return s.preference
+}
+
+func (s *slush) Finalized() bool {
+	return s.rounds >= s.parameters.Rounds
+}
@@ -1,99 +1,61 @@
 package consensus
 
 import (
-	"context"
 	"github.com/pkg/errors"
-	"reflect"
 )
 
-type Consensus struct {
-	parameters Parameters
+// snowball only flips to the choice that has been the α-majority of the most polls
+type snowball struct {
+	snowflake
 	preference []byte
-	confidence int
-	isRunning  bool
+	// preferenceStrength is d[color] in the paper
+	preferenceStrength    map[string]int
+	maxPreferenceStrength int
 }
 
-func NewConsensus(parameters Parameters, preference []byte) (*Consensus, error) {
-	err := parameters.Verify()
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to verify the consensus configuration")
-	}
-
-	consensus := &Consensus{
-		parameters: parameters,
-		confidence: 0,
-		isRunning:  false,
-		preference: preference,
+func newSnowball(parameters Parameters, preference []byte) *snowball {
+	return &snowball{
+		snowflake:          *newSnowflake(parameters, preference),
+		preference:         preference,
+		preferenceStrength: make(map[string]int),
 	}
-
-	return consensus, nil
 }
 
-// Sync synchronize data between the peers
-//
-// Ref: https://github.com/ava-labs/mastering-avalanche/blob/main/chapter_09.md
-func (c *Consensus) Sync(ctx context.Context, setNewBlockDataFunc func([]byte) error, getBlockDataFromRandomKFunc func(int) ([][]byte, error)) error {
-	if c.isRunning {
-		return errors.New("consensus is running")
+func (s *snowball) RecordPoll(preferences [][]byte) error {
+	s.observe(preferences)
+	frequent, preference, err := GetMostFrequentPreference(preferences)
+	if err != nil {
+		return errors.Wrap(err, "unable to get the most frequent")
 	}
-	c.isRunning = true
-	c.confidence = 1
-	for c.confidence < c.parameters.Beta {
-		if !c.isRunning {
-			break
-		}
-		// ask k random peers to get the preferences
-		preferenceFromK, err := getBlockDataFromRandomKFunc(c.parameters.K)
-		if err != nil {
-			return errors.Wrap(err, "unable to get get block data from cb function")
-		}
-		if len(preferenceFromK) < c.parameters.K {
-			continue
-		}
-		frequent, preference, err := c.GetMostFrequentPreference(preferenceFromK)
-		if err != nil {
-			return errors.Wrap(err, "unable to get the most frequent")
-		}
-		// if the most frequent item is larger α
-		if frequent >= c.parameters.Alpha {
-			oldPreference := c.preference
-			c.preference = preference
-			// set the current data block to the new preference
-			err := setNewBlockDataFunc(c.preference)
-			if err != nil {
-				return errors.Wrap(err, "unable to update the preference")
-			}
-
-			if reflect.DeepEqual(oldPreference, c.preference) {
-				c.confidence++
-			} else {
-				c.confidence = 1
-			}
-		} else {
-			c.confidence = 0
-		}
+	// if the most frequent item is larger α
+	if frequent >= s.parameters.Alpha {
+		s.RecordSuccessfulPoll(preference)
+	} else {
+		s.RecordUnsuccessfulPoll()
 	}
-	c.isRunning = false
 	return nil
 }
 
-func (c *Consensus) GetMostFrequentPreference(preferences [][]byte) (int, []byte, error) {
-	if len(preferences) == 0 {
-		return 0, nil, errors.New("the preferences is empty")
+func (s *snowball) RecordSuccessfulPoll(choice []byte) {
+	if s.finalized {
+		return
 	}
-	var count int
-	var preference []byte
-	for _, preference1 := range preferences {
-		maxCount := 0
-		for _, preference2 := range preferences {
-			if reflect.DeepEqual(preference1, preference2) {
-				maxCount++
-			}
-		}
-		if maxCount > count {
-			count = maxCount
-			preference = preference1
-		}
+	key := string(choice)
+	s.preferenceStrength[key]++
+	if strength := s.preferenceStrength[key]; strength > s.maxPreferenceStrength {
+		s.maxPreferenceStrength = strength
+		s.preference = choice
 	}
-	return count, preference, nil
+	s.snowflake.RecordSuccessfulPoll(choice)
+}
+
+func (s *snowball) Preference() []byte {
+	if s.finalized {
+		return s.snowflake.Preference()
+	}
+	return s.preference
+}
+
+func (s *snowball) PreferenceStrength(choice []byte) int {
+	return s.preferenceStrength[string(choice)]
 }
@@ -0,0 +1,148 @@
+package consensus
+
+import (
+	"bytes"
+	"testing"
+)
+
+const unsuccessful = ""
+
+func TestSnowballRecordPoll(t *testing.T) {
+	tests := []struct {
+		name         string
+		betaVirtuous int
+		// polls are the choices of the successful polls, unsuccessful for a poll without α-majority
+		polls      []string
+		preference string
+		confidence int
+		finalized  bool
+		strengths  map[string]int
+	}{
+		{
+			name:         "a single contrary α-majority does not flip the preference",
+			betaVirtuous: 3,
+			polls:        []string{"a", "b"},
+			preference:   "a",
+			confidence:   1,
+			strengths:    map[string]int{"a": 1, "b": 1},
+		},
+		{
+			name:         "the preference flips when the contrary choice is stronger",
+			betaVirtuous: 5,
+			polls:        []string{"a", "b", "b"},
+			preference:   "b",
+			confidence:   2,
+			strengths:    map[string]int{"a": 1, "b": 2},
+		},
+		{
+			name:         "a tie of the strengths keeps the choice that reached it first",
+			betaVirtuous: 5,
+			polls:        []string{"b", "a", "a", "b"},
+			preference:   "a",
+			confidence:   1,
+			strengths:    map[string]int{"a": 2, "b": 2},
+		},
+		{
+			name:         "β consecutive successful polls finalize",
+			betaVirtuous: 3,
+			polls:        []string{"a", "a", "a"},
+			preference:   "a",
+			confidence:   3,
+			finalized:    true,
+			strengths:    map[string]int{"a": 3},
+		},
+		{
+			name:         "an unsuccessful poll resets the confidence",
+			betaVirtuous: 3,
+			polls:        []string{"a", "a", unsuccessful, "a"},
+			preference:   "a",
+			confidence:   1,
+			strengths:    map[string]int{"a": 3},
+		},
+		{
+			name:         "the decision is the choice that reached β even when another choice is stronger",
+			betaVirtuous: 2,
+			polls:        []string{"a", unsuccessful, "a", unsuccessful, "a", "b", "b"},
+			preference:   "b",
+			confidence:   2,
+			finalized:    true,
+			strengths:    map[string]int{"a": 3, "b": 2},
+		},
+		{
+			name:         "the polls after the finalization are ignored",
+			betaVirtuous: 2,
+			polls:        []string{"a", "a", "b", "b", "b"},
+			preference:   "a",
+			confidence:   2,
+			finalized:    true,
+			strengths:    map[string]int{"a": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSnowball(Parameters{
+				K:                   5,
+				Alpha:               3,
+				BetaVirtuous:        tt.betaVirtuous,
+				BetaRogue:           tt.betaVirtuous,
+				ConcurrentRepolls:   1,
+				MaxOutstandingItems: 1,
+			}, []byte("a"))
+			for _, poll := range tt.polls {
+				if poll == unsuccessful {
+					s.RecordUnsuccessfulPoll()
+					continue
+				}
+				s.RecordSuccessfulPoll([]byte(poll))
+			}
+			if !bytes.Equal(s.Preference(), []byte(tt.preference)) {
+				t.Errorf("preference = %s, want %s", s.Preference(), tt.preference)
+			}
+			if s.Confidence() != tt.confidence {
+				t.Errorf("confidence = %d, want %d", s.Confidence(), tt.confidence)
+			}
+			if s.Finalized() != tt.finalized {
+				t.Errorf("finalized = %v, want %v", s.Finalized(), tt.finalized)
+			}
+			for choice, strength := range tt.strengths {
+				if got := s.PreferenceStrength([]byte(choice)); got != strength {
+					t.Errorf("preference strength of %s = %d, want %d", choice, got, strength)
+				}
+			}
+		})
+	}
+}
+
+func TestSnowballRecordPollWithPreferences(t *testing.T) {
+	s := newSnowball(Parameters{
+		K:                   5,
+		Alpha:               3,
+		BetaVirtuous:        2,
+		BetaRogue:           3,
+		ConcurrentRepolls:   1,
+		MaxOutstandingItems: 1,
+	}, []byte("a"))
+	polls := [][][]byte{
+		// a contrary α-majority, the decision becomes rogue
+		{[]byte("b"), []byte("b"), []byte("b"), []byte("a"), []byte("a")},
+		{[]byte("a"), []byte("a"), []byte("a"), []byte("b"), []byte("b")},
+		// no α-majority
+		{[]byte("a"), []byte("a"), []byte("b"), []byte("b"), []byte("c")},
+		{[]byte("a"), []byte("a"), []byte("a"), []byte("a"), []byte("b")},
+		{[]byte("a"), []byte("a"), []byte("a"), []byte("a"), []byte("a")},
+		// the third consecutive successful poll reaches BetaRogue
+		{[]byte("a"), []byte("a"), []byte("a"), []byte("c"), []byte("a")},
+	}
+	for i, poll := range polls {
+		err := s.RecordPoll(poll)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Finalized() != (i == len(polls)-1) {
+			t.Fatalf("poll %d: finalized = %v", i, s.Finalized())
+		}
+	}
+	if !bytes.Equal(s.Preference(), []byte("a")) {
+		t.Errorf("preference = %s, want a", s.Preference())
+	}
+}
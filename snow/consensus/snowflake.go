@@ -0,0 +1,86 @@
+package consensus
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+)
+
+// snowflake needs BetaRogue consecutive successful polls once a conflicting choice has been seen
+type snowflake struct {
+	parameters Parameters
+	preference []byte
+	confidence int
+	rogue      bool
+	finalized  bool
+}
+
+func newSnowflake(parameters Parameters, preference []byte) *snowflake {
+	return &snowflake{
+		parameters: parameters,
+		preference: preference,
+	}
+}
+
+func (s *snowflake) Parameters() Parameters {
+	return s.parameters
+}
+
+func (s *snowflake) RecordPoll(preferences [][]byte) error {
+	s.observe(preferences)
+	frequent, preference, err := GetMostFrequentPreference(preferences)
+	if err != nil {
+		return errors.Wrap(err, "unable to get the most frequent")
+	}
+	// if the most frequent item is larger α
+	if frequent >= s.parameters.Alpha {
+		s.RecordSuccessfulPoll(preference)
+	} else {
+		s.RecordUnsuccessfulPoll()
+	}
+	return nil
+}
+
+func (s *snowflake) RecordSuccessfulPoll(choice []byte) {
+	if s.finalized {
+		return
+	}
+	if bytes.Equal(s.preference, choice) {
+		s.confidence++
+	} else {
+		s.preference = choice
+		s.confidence = 1
+	}
+	s.finalized = s.confidence >= s.beta()
+}
+
+func (s *snowflake) RecordUnsuccessfulPoll() {
+	s.confidence = 0
+}
+
+func (s *snowflake) Preference() []byte {
+	return s.preference
+}
+
+func (s *snowflake) Confidence() int {
+	return s.confidence
+}
+
+func (s *snowflake) Finalized() bool {
+	return s.finalized
+}
+
+func (s *snowflake) observe(preferences [][]byte) {
+	for _, preference := range preferences {
+		if !bytes.Equal(preference, s.preference) {
+			s.rogue = true
+			return
+		}
+	}
+}
+
+func (s *snowflake) beta() int {
+	if s.rogue {
+		return s.parameters.BetaRogue
+	}
+	return s.parameters.BetaVirtuous
+}
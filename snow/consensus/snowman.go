@@ -0,0 +1,21 @@
+package consensus
+
+// snowman runs snowball on a block of a linear chain, the block is only final once its parent is
+type snowman struct {
+	snowball
+	parent Consensus
+}
+
+func newSnowman(parameters Parameters, preference []byte, parent Consensus) *snowman {
+	return &snowman{
+		snowball: *newSnowball(parameters, preference),
+		parent:   parent,
+	}
+}
+
+func (s *snowman) Finalized() bool {
+	if s.parent != nil && !s.parent.Finalized() {
+		return false
+	}
+	return s.snowball.Finalized()
+}
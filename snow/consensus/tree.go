@@ -0,0 +1,282 @@
+package consensus
+
+import (
+	"crypto/sha256"
+)
+
+const idBits = sha256.Size * 8
+
+// id is the hash of the choice so every choice has the same length
+type id [sha256.Size]byte
+
+func newID(choice []byte) id {
+	return sha256.Sum256(choice)
+}
+
+func (i id) bit(index int) int {
+	return int(i[index/8]>>(7-uint(index%8))) & 1
+}
+
+// firstDifferentBit returns the first bit in [from, to) where the IDs are different, or to if they are equal
+func firstDifferentBit(a, b id, from, to int) int {
+	for i := from; i < to; i++ {
+		if a.bit(i) != b.bit(i) {
+			return i
+		}
+	}
+	return to
+}
+
+type bag map[id]int
+
+func (b bag) len() int {
+	count := 0
+	for _, c := range b {
+		count += c
+	}
+	return count
+}
+
+// filter returns the votes for the IDs having the same bits as the preference in [from, to)
+func (b bag) filter(from, to int, preference id) bag {
+	filtered := make(bag)
+	for vote, count := range b {
+		if firstDifferentBit(vote, preference, from, to) == to {
+			filtered[vote] = count
+		}
+	}
+	return filtered
+}
+
+func (b bag) split(index int) [2]bag {
+	splitVotes := [2]bag{make(bag), make(bag)}
+	for vote, count := range b {
+		splitVotes[vote.bit(index)][vote] = count
+	}
+	return splitVotes
+}
+
+// tree runs a binary Snowball on every bit where the choices differ and a unary one on the bits they share
+//
+// Ref: https://github.com/ava-labs/avalanchego/blob/master/snow/consensus/snowball/tree.go
+type tree struct {
+	parameters Parameters
+	choices    map[id][]byte
+	root       treeNode
+}
+
+type treeNode interface {
+	add(choice id) treeNode
+	// reset is set when the parent had an unsuccessful poll since the last poll of the node
+	recordPoll(votes bag, reset bool) treeNode
+	preference() id
+	finalized() bool
+}
+
+func newTree(parameters Parameters, preference []byte) *tree {
+	choice := newID(preference)
+	return &tree{
+		parameters: parameters,
+		choices: map[id][]byte{
+			choice: preference,
+		},
+		root: &unaryNode{
+			parameters:    parameters,
+			pref:          choice,
+			decidedPrefix: 0,
+			commonPrefix:  idBits,
+		},
+	}
+}
+
+func (t *tree) Parameters() Parameters {
+	return t.parameters
+}
+
+func (t *tree) RecordPoll(preferences [][]byte) error {
+	votes := make(bag)
+	for _, preference := range preferences {
+		choice := newID(preference)
+		if _, ok := t.choices[choice]; !ok {
+			t.choices[choice] = preference
+			t.root = t.root.add(choice)
+		}
+		votes[choice]++
+	}
+	t.root = t.root.recordPoll(votes, false)
+	return nil
+}
+
+func (t *tree) Preference() []byte {
+	return t.choices[t.root.preference()]
+}
+
+func (t *tree) Finalized() bool {
+	return t.root.finalized()
+}
+
+// unaryNode is a decision on the bits [decidedPrefix, commonPrefix) that all choices below the node share
+type unaryNode struct {
+	parameters Parameters
+	pref       id
+	// decidedPrefix is the index of the first bit of the node, the bits before are decided by the ancestors
+	decidedPrefix int
+	// commonPrefix is the index of the first bit where the choices below the node differ
+	commonPrefix int
+	// strength, confidence and final are the state of the unary Snowball instance, it only has one choice
+	strength    int
+	confidence  int
+	final       bool
+	shouldReset bool
+	child       treeNode
+}
+
+func (u *unaryNode) add(choice id) treeNode {
+	if u.final {
+		return u
+	}
+	index := firstDifferentBit(u.pref, choice, u.decidedPrefix, u.commonPrefix)
+	if index == u.commonPrefix {
+		if u.child != nil {
+			u.child = u.child.add(choice)
+		}
+		return u
+	}
+
+	// the choice differs at the index, the bits after it become two branches of a binary node
+	bit := u.pref.bit(index)
+	b := &binaryNode{
+		parameters: u.parameters,
+		bit:        index,
+		pref:       bit,
+		lastPoll:   bit,
+		confidence: u.confidence,
+	}
+	b.strength[bit] = u.strength
+	b.preferences[bit] = u.pref
+	b.preferences[1-bit] = choice
+	b.children[bit] = &unaryNode{
+		parameters:    u.parameters,
+		pref:          u.pref,
+		decidedPrefix: index + 1,
+		commonPrefix:  u.commonPrefix,
+		strength:      u.strength,
+		confidence:    u.confidence,
+		final:         u.final,
+		shouldReset:   u.shouldReset,
+		child:         u.child,
+	}
+	b.children[1-bit] = &unaryNode{
+		parameters:    u.parameters,
+		pref:          choice,
+		decidedPrefix: index + 1,
+		commonPrefix:  idBits,
+	}
+	if index == u.decidedPrefix {
+		return b
+	}
+	u.commonPrefix = index
+	u.child = b
+	return u
+}
+
+func (u *unaryNode) recordPoll(votes bag, reset bool) treeNode {
+	if u.shouldReset || reset {
+		u.confidence = 0
+		u.shouldReset = true
+	}
+	filteredVotes := votes.filter(u.decidedPrefix, u.commonPrefix, u.pref)
+	if filteredVotes.len() < u.parameters.Alpha {
+		u.confidence = 0
+		u.shouldReset = true
+		return u
+	}
+	if !u.final {
+		u.strength++
+		u.confidence++
+		u.final = u.confidence >= u.parameters.BetaVirtuous
+	}
+	if u.child != nil {
+		u.child = u.child.recordPoll(filteredVotes, u.shouldReset)
+		u.pref = u.child.preference()
+	}
+	u.shouldReset = false
+	return u
+}
+
+func (u *unaryNode) preference() id {
+	return u.pref
+}
+
+func (u *unaryNode) finalized() bool {
+	return u.final && (u.child == nil || u.child.finalized())
+}
+
+type binaryNode struct {
+	parameters Parameters
+	bit        int
+	// preferences are the preferred choices of both branches
+	preferences [2]id
+	pref        int
+	strength    [2]int
+	lastPoll    int
+	confidence  int
+	final       bool
+	shouldReset [2]bool
+	children    [2]treeNode
+}
+
+func (b *binaryNode) add(choice id) treeNode {
+	bit := choice.bit(b.bit)
+	b.children[bit] = b.children[bit].add(choice)
+	return b
+}
+
+func (b *binaryNode) recordPoll(votes bag, reset bool) treeNode {
+	splitVotes := votes.split(b.bit)
+	bit := 0
+	if splitVotes[0].len() < splitVotes[1].len() {
+		bit = 1
+	}
+	if reset {
+		b.confidence = 0
+		b.shouldReset[bit] = true
+	}
+	// the other branch did not get the votes, its decision has to restart
+	b.shouldReset[1-bit] = true
+
+	prunedVotes := splitVotes[bit]
+	if prunedVotes.len() < b.parameters.Alpha {
+		b.confidence = 0
+		b.shouldReset[bit] = true
+		return b
+	}
+	if !b.final {
+		b.strength[bit]++
+		if b.strength[bit] > b.strength[1-bit] {
+			b.pref = bit
+		}
+		if b.lastPoll == bit {
+			b.confidence++
+		} else {
+			b.lastPoll = bit
+			b.confidence = 1
+		}
+		b.final = b.confidence >= b.parameters.BetaRogue
+		if b.final {
+			b.pref = b.lastPoll
+		}
+	}
+	b.children[bit] = b.children[bit].recordPoll(prunedVotes, b.shouldReset[bit])
+	b.preferences[bit] = b.children[bit].preference()
+	b.shouldReset[bit] = false
+	return b
+}
+
+func (b *binaryNode) preference() id {
+	return b.preferences[b.pref]
+}
+
+func (b *binaryNode) finalized() bool {
+	return b.final && b.children[b.pref].finalized()
+}
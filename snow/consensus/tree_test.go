@@ -0,0 +1,273 @@
+package consensus
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func treeParameters(betaVirtuous, betaRogue int) Parameters {
+	return Parameters{
+		Algorithm:           SnowballTreeAlgorithm,
+		K:                   5,
+		Alpha:               4,
+		BetaVirtuous:        betaVirtuous,
+		BetaRogue:           betaRogue,
+		ConcurrentRepolls:   1,
+		MaxOutstandingItems: 1,
+	}
+}
+
+func votes(counts map[string]int) [][]byte {
+	preferences := make([][]byte, 0)
+	for _, choice := range []string{"a", "b", "c"} {
+		for i := 0; i < counts[choice]; i++ {
+			preferences = append(preferences, []byte(choice))
+		}
+	}
+	return preferences
+}
+
+func TestTreeSplitsUnaryNode(t *testing.T) {
+	tr := newTree(treeParameters(2, 5), []byte("a"))
+	if _, ok := tr.root.(*unaryNode); !ok {
+		t.Fatalf("the root of a single choice is a %T", tr.root)
+	}
+	if err := tr.RecordPoll(votes(map[string]int{"a": 4, "b": 1})); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := newID([]byte("a")), newID([]byte("b"))
+	index := firstDifferentBit(a, b, 0, idBits)
+	var binary *binaryNode
+	switch root := tr.root.(type) {
+	case *binaryNode:
+		binary = root
+	case *unaryNode:
+		if root.commonPrefix != index {
+			t.Fatalf("the common prefix of the root is %d, want %d", root.commonPrefix, index)
+		}
+		binary, _ = root.child.(*binaryNode)
+	}
+	if binary == nil {
+		t.Fatal("the choices are not split by a binary node")
+	}
+	if binary.bit != index {
+		t.Errorf("the binary node decides the bit %d, want %d", binary.bit, index)
+	}
+	for _, choice := range []id{a, b} {
+		leaf, ok := binary.children[choice.bit(index)].(*unaryNode)
+		if !ok {
+			t.Fatalf("the branch of the bit %d is not a unary node", choice.bit(index))
+		}
+		if leaf.pref != choice || leaf.decidedPrefix != index+1 || leaf.commonPrefix != idBits {
+			t.Errorf("the branch of the bit %d does not decide the bits after the split", choice.bit(index))
+		}
+	}
+	if !bytes.Equal(tr.Preference(), []byte("a")) {
+		t.Errorf("preference = %s, want a", tr.Preference())
+	}
+}
+
+func TestTreeFinalization(t *testing.T) {
+	tests := []struct {
+		name string
+		// first is the first poll, the next polls are all for a
+		first map[string]int
+		// polls is the number of polls until the tree is finalized
+		polls int
+	}{
+		{
+			name:  "a virtuous choice is finalized after BetaVirtuous polls",
+			first: map[string]int{"a": 5},
+			polls: 2,
+		},
+		{
+			name:  "a choice with a conflict is finalized after BetaRogue polls",
+			first: map[string]int{"a": 4, "b": 1},
+			polls: 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := newTree(treeParameters(2, 5), []byte("a"))
+			poll := tt.first
+			for i := 1; i <= tt.polls; i++ {
+				if tr.Finalized() {
+					t.Fatalf("finalized after %d polls, want %d", i-1, tt.polls)
+				}
+				if err := tr.RecordPoll(votes(poll)); err != nil {
+					t.Fatal(err)
+				}
+				poll = map[string]int{"a": 5}
+			}
+			if !tr.Finalized() {
+				t.Fatalf("not finalized after %d polls", tt.polls)
+			}
+			if !bytes.Equal(tr.Preference(), []byte("a")) {
+				t.Errorf("preference = %s, want a", tr.Preference())
+			}
+		})
+	}
+}
+
+func TestTreePreferenceAfterSplit(t *testing.T) {
+	tr := newTree(treeParameters(10, 10), []byte("a"))
+	steps := []struct {
+		poll       map[string]int
+		preference string
+	}{
+		// the strength of a is kept by its branch when b splits the node
+		{poll: map[string]int{"a": 5}, preference: "a"},
+		{poll: map[string]int{"b": 5}, preference: "a"},
+		{poll: map[string]int{"b": 4, "a": 1}, preference: "b"},
+		// a third choice splits the tree again, b keeps the preference until c is stronger
+		{poll: map[string]int{"c": 4, "b": 1}, preference: "b"},
+		{poll: map[string]int{"c": 5}, preference: "b"},
+		{poll: map[string]int{"c": 5}, preference: "c"},
+	}
+	for i, step := range steps {
+		if err := tr.RecordPoll(votes(step.poll)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(tr.Preference(), []byte(step.preference)) {
+			t.Fatalf("poll %d: preference = %s, want %s", i, tr.Preference(), step.preference)
+		}
+	}
+}
+
+func benchmarkPolls(numOfChoices, k int) [][][]byte {
+	r := rand.New(rand.NewSource(1))
+	choices := make([][]byte, numOfChoices)
+	for i := range choices {
+		choices[i] = []byte(fmt.Sprintf("choice-%d", i))
+	}
+	polls := make([][][]byte, 1024)
+	for i := range polls {
+		polls[i] = make([][]byte, k)
+		for j := range polls[i] {
+			if r.Intn(2) == 0 {
+				polls[i][j] = choices[0]
+				continue
+			}
+			polls[i][j] = choices[r.Intn(numOfChoices)]
+		}
+	}
+	return polls
+}
+
+func BenchmarkGetMostFrequentPreference(b *testing.B) {
+	for _, numOfChoices := range []int{2, 16, 256} {
+		polls := benchmarkPolls(numOfChoices, 20)
+		b.Run(fmt.Sprintf("choices=%d", numOfChoices), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, _ = GetMostFrequentPreference(polls[i%len(polls)])
+			}
+		})
+	}
+}
+
+func BenchmarkSnowball(b *testing.B) {
+	benchmarkConsensus(b, func(parameters Parameters, preference []byte) Consensus {
+		return newSnowball(parameters, preference)
+	})
+}
+
+func BenchmarkTree(b *testing.B) {
+	benchmarkConsensus(b, func(parameters Parameters, preference []byte) Consensus {
+		return newTree(parameters, preference)
+	})
+}
+
+func benchmarkConsensus(b *testing.B, newConsensus func(Parameters, []byte) Consensus) {
+	parameters := Parameters{
+		K:                   20,
+		Alpha:               11,
+		BetaVirtuous:        1 << 30,
+		BetaRogue:           1 << 30,
+		ConcurrentRepolls:   1,
+		MaxOutstandingItems: 1,
+	}
+	for _, numOfChoices := range []int{2, 16, 256} {
+		polls := benchmarkPolls(numOfChoices, parameters.K)
+		b.Run(fmt.Sprintf("choices=%d", numOfChoices), func(b *testing.B) {
+			c := newConsensus(parameters, polls[0][0])
+			for i := 0; i < b.N; i++ {
+				if err := c.RecordPoll(polls[i%len(polls)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkConvergence uses the next seed in every iteration, e.g. -benchtime=10x runs 10 seeds
+func BenchmarkConvergence(b *testing.B) {
+	const (
+		numOfNodes = 200
+		maxRounds  = 2000
+	)
+	parameters := Parameters{
+		K:                   20,
+		Alpha:               15,
+		BetaVirtuous:        15,
+		BetaRogue:           20,
+		ConcurrentRepolls:   1,
+		MaxOutstandingItems: 1,
+	}
+	for _, algorithm := range []Algorithm{SnowballAlgorithm, SnowballTreeAlgorithm} {
+		for _, numOfChoices := range []int{2, 16, 200} {
+			parameters.Algorithm = algorithm
+			b.Run(fmt.Sprintf("%s/choices=%d", algorithm, numOfChoices), func(b *testing.B) {
+				var rounds, agreed int
+				for i := 0; i < b.N; i++ {
+					n, ok := converge(b, parameters, numOfNodes, numOfChoices, maxRounds, int64(i+1))
+					rounds += n
+					if ok {
+						agreed++
+					}
+				}
+				b.ReportMetric(float64(rounds)/float64(b.N), "rounds/op")
+				b.ReportMetric(float64(agreed)/float64(b.N), "agreed/op")
+			})
+		}
+	}
+}
+
+func converge(b *testing.B, parameters Parameters, numOfNodes, numOfChoices, maxRounds int, seed int64) (int, bool) {
+	r := rand.New(rand.NewSource(seed))
+	nodes := make([]Consensus, numOfNodes)
+	for j := range nodes {
+		c, err := NewConsensus(parameters, []byte(fmt.Sprintf("choice-%d", r.Intn(numOfChoices))), nil)
+		if err != nil {
+			b.Fatal(err)
+		}
+		nodes[j] = c
+	}
+	for round := 1; round <= maxRounds; round++ {
+		finalized := true
+		for _, c := range nodes {
+			if c.Finalized() {
+				continue
+			}
+			finalized = false
+			preferences := make([][]byte, 0, parameters.K)
+			for _, j := range r.Perm(numOfNodes)[:parameters.K] {
+				preferences = append(preferences, nodes[j].Preference())
+			}
+			if err := c.RecordPoll(preferences); err != nil {
+				b.Fatal(err)
+			}
+		}
+		if finalized {
+			for _, c := range nodes[1:] {
+				if !bytes.Equal(c.Preference(), nodes[0].Preference()) {
+					return round, false
+				}
+			}
+			return round, true
+		}
+	}
+	return maxRounds, false
+}
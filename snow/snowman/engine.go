@@ -0,0 +1,379 @@
+package snowman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/log"
+	"github.com/tiennampham23/avalanche-consensus-simulator/pkg/random"
+	"github.com/tiennampham23/avalanche-consensus-simulator/report"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/validators"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type PushBlockRequest struct {
+	From  string       `json:"from"`
+	Block *chain.Block `json:"block"`
+}
+
+type PullQueryRequest struct {
+	Height uint64 `json:"height"`
+}
+
+type PullQueryResponse struct {
+	BlockHash string `json:"blockHash"`
+}
+
+type GetBlockRequest struct {
+	Hash string `json:"hash"`
+}
+
+type GetBlockResponse struct {
+	Block *chain.Block `json:"block"`
+}
+
+// candidatesWait is how long a node without a proposal at the next height waits before polling its peers again
+const candidatesWait = 100 * time.Millisecond
+
+// Engine accepts the decided child of the last accepted block and rejects the other children
+type Engine struct {
+	parameters consensus.Parameters
+	client     *p2p.Client
+	state      *chain.BlockChainState
+	rand       *rand.Rand
+	recorder   *report.NodeRecorder
+	mu         sync.Mutex
+	// candidates are the children of the last accepted block
+	candidates map[string]*chain.Block
+	// preferred is empty when no candidate is known
+	preferred string
+	accepted  map[string]*chain.Block
+	rejected  int
+	last      consensus.Consensus
+}
+
+// NewEngine takes a recorder that may be nil
+func NewEngine(parameters consensus.Parameters, seed int64, recorder *report.NodeRecorder) (*Engine, error) {
+	err := parameters.Verify()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to verify the consensus configuration")
+	}
+	return &Engine{
+		parameters: parameters,
+		rand:       random.New(seed),
+		recorder:   recorder,
+		candidates: make(map[string]*chain.Block),
+		accepted:   make(map[string]*chain.Block),
+	}, nil
+}
+
+func (e *Engine) SetClient(client *p2p.Client) {
+	e.client = client
+}
+
+func (e *Engine) SetChain(state *chain.BlockChainState) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.state = state
+}
+
+func (e *Engine) Router(t p2p.Transport) {
+	t.Register("snowman/push-block", e.PushBlock)
+	t.Register("snowman/pull-query", e.PullQuery)
+	t.Register("snowman/get-block", e.GetBlock)
+}
+
+func (e *Engine) PushBlock(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req PushBlockRequest
+	if err := json.Unmarshal(payload, &req); err != nil || req.Block == nil {
+		return nil, errors.New("invalid push block request")
+	}
+	err := e.addCandidate(req.Block)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal("OK")
+}
+
+// PullQuery answers the accepted block at the height, or the preferred child of the last accepted block
+func (e *Engine) PullQuery(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req PullQueryRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid pull query request")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.state == nil {
+		return nil, errors.New("the chain is not set")
+	}
+	tip := e.state.LastBlock()
+	if tip == nil {
+		return nil, errors.New("the chain has no genesis block")
+	}
+	var hash string
+	switch {
+	case req.Height <= tip.Height:
+		block, ok := e.state.Block(req.Height)
+		if !ok {
+			return nil, fmt.Errorf("the block at the height %d is unknown", req.Height)
+		}
+		hash = block.BlockHash
+	case req.Height == tip.Height+1 && e.preferred != "":
+		hash = e.preferred
+	default:
+		return nil, fmt.Errorf("no preference at the height %d", req.Height)
+	}
+	return json.Marshal(PullQueryResponse{
+		BlockHash: hash,
+	})
+}
+
+func (e *Engine) GetBlock(ctx context.Context, from string, payload []byte) ([]byte, error) {
+	var req GetBlockRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, errors.New("invalid get block request")
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	block, ok := e.candidates[req.Hash]
+	if !ok {
+		block, ok = e.accepted[req.Hash]
+	}
+	if !ok {
+		return nil, fmt.Errorf("the block %s is unknown", req.Hash)
+	}
+	return json.Marshal(GetBlockResponse{
+		Block: block,
+	})
+}
+
+func (e *Engine) Rejected() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.rejected
+}
+
+// Run needs a chain starting with the genesis block, the node proposes nothing when propose is nil
+func (e *Engine) Run(ctx context.Context, numOfBlocks int, propose func(parent *chain.Block) *chain.Block) error {
+	tip := e.state.LastBlock()
+	if tip == nil {
+		return errors.New("the chain has no genesis block")
+	}
+	// the chain may have been reloaded or bootstrapped, the pushed blocks that are not children of its last block are left out
+	e.mu.Lock()
+	for height := uint64(0); height <= tip.Height; height++ {
+		block, ok := e.state.Block(height)
+		if ok {
+			e.accepted[block.BlockHash] = block
+		}
+	}
+	for hash, block := range e.candidates {
+		if block.Verify(tip) != nil {
+			delete(e.candidates, hash)
+		}
+	}
+	if _, ok := e.candidates[e.preferred]; !ok {
+		e.preferred = ""
+		for hash := range e.candidates {
+			e.preferred = hash
+			break
+		}
+	}
+	e.mu.Unlock()
+	for tip.Height < uint64(numOfBlocks) {
+		if propose != nil {
+			err := e.propose(ctx, propose(tip))
+			if err != nil {
+				return errors.Wrap(err, "unable to propose the block")
+			}
+		}
+		err := e.decide(ctx, tip)
+		if err != nil {
+			return errors.Wrap(err, fmt.Sprintf("unable to decide the height %d", tip.Height+1))
+		}
+		tip = e.state.LastBlock()
+	}
+	return nil
+}
+
+func (e *Engine) propose(ctx context.Context, block *chain.Block) error {
+	err := e.addCandidate(block)
+	if err != nil {
+		return err
+	}
+	peers, err := e.client.Peers()
+	if err != nil {
+		return errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	req := PushBlockRequest{
+		From:  e.client.Peer().Address,
+		Block: block,
+	}
+	for _, peer := range peers {
+		if peer == nil || peer.Address == e.client.Peer().Address {
+			continue
+		}
+		err := e.client.Send(ctx, peer, "snowman/push-block", req)
+		if err != nil {
+			log.Debugf("unable to push the block %s to %s: %v", block.BlockHash, peer.Address, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) decide(ctx context.Context, tip *chain.Block) error {
+	height := tip.Height + 1
+	// a node that did not receive any proposal yet learns them from the answers of its peers
+	for e.preference() == "" {
+		_, err := e.poll(ctx, height, e.parameters.K)
+		if err != nil {
+			return err
+		}
+		if e.preference() != "" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(candidatesWait):
+		}
+	}
+	c, err := consensus.NewConsensus(e.parameters, []byte(e.preference()), e.last)
+	if err != nil {
+		return err
+	}
+	c = e.client.Metrics().Observe(e.recorder.Observe(int(height)-1, c))
+	setPreferenceCb := func(hash []byte) error {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.preferred = string(hash)
+		return nil
+	}
+	getPreferencesFromRandomKCb := func(ctx context.Context, k int) ([][]byte, error) {
+		return e.poll(ctx, height, k)
+	}
+	err = consensus.Sync(ctx, c, setPreferenceCb, getPreferencesFromRandomKCb)
+	if err != nil {
+		return err
+	}
+	e.last = c
+	return e.accept(string(c.Preference()))
+}
+
+// poll leaves out the answers for blocks that are not children of the last accepted block
+func (e *Engine) poll(ctx context.Context, height uint64, k int) ([][]byte, error) {
+	e.client.Metrics().PollIssued()
+	peers, err := e.client.Peers()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to get the peers from the discovery")
+	}
+	preferences := make([][]byte, 0, k)
+	weights := make([]uint64, 0, k)
+	for _, i := range validators.SamplePeers(e.rand, peers) {
+		peer := peers[i]
+		if peer == nil {
+			continue
+		}
+		var resp PullQueryResponse
+		err := e.client.Request(ctx, peer, "snowman/pull-query", PullQueryRequest{Height: height}, &resp)
+		if err != nil || resp.BlockHash == "" {
+			continue
+		}
+		if !e.isCandidate(resp.BlockHash) {
+			err = e.fetch(ctx, peer, resp.BlockHash)
+			if err != nil {
+				log.Debugf("unable to fetch the block %s from %s: %v", resp.BlockHash, peer.Address, err)
+				continue
+			}
+		}
+		preferences = append(preferences, []byte(resp.BlockHash))
+		weights = append(weights, peer.Weight)
+		if len(preferences) >= k {
+			break
+		}
+	}
+	if e.parameters.StakeAlpha {
+		return consensus.WeighPoll(preferences, weights), nil
+	}
+	return preferences, nil
+}
+
+func (e *Engine) fetch(ctx context.Context, peer *p2p.Peer, hash string) error {
+	var resp GetBlockResponse
+	err := e.client.Request(ctx, peer, "snowman/get-block", GetBlockRequest{Hash: hash}, &resp)
+	if err != nil {
+		return err
+	}
+	if resp.Block == nil || resp.Block.BlockHash != hash {
+		return errors.New("the peer returned another block")
+	}
+	return e.addCandidate(resp.Block)
+}
+
+// addCandidate prefers the block when no other child is known
+func (e *Engine) addCandidate(block *chain.Block) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.candidates[block.BlockHash]; ok {
+		return nil
+	}
+	if _, ok := e.accepted[block.BlockHash]; ok {
+		return nil
+	}
+	if e.state == nil {
+		return errors.New("the chain is not set")
+	}
+	err := block.Verify(e.state.LastBlock())
+	if err != nil {
+		return errors.Wrap(err, "the block is not a child of the last accepted block")
+	}
+	e.candidates[block.BlockHash] = block
+	if e.preferred == "" {
+		e.preferred = block.BlockHash
+	}
+	return nil
+}
+
+func (e *Engine) accept(hash string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	block, ok := e.candidates[hash]
+	if !ok {
+		return fmt.Errorf("the decided block %s is unknown", hash)
+	}
+	err := e.state.Add(block)
+	if err != nil {
+		return err
+	}
+	err = e.state.Decide(int(block.Height))
+	if err != nil {
+		return err
+	}
+	e.accepted[hash] = block
+	if rejected := len(e.candidates) - 1; rejected > 0 {
+		e.rejected += rejected
+		log.Debugf("the block %s is accepted at the height %d, %d competing blocks are rejected", hash, block.Height, rejected)
+	}
+	e.candidates = make(map[string]*chain.Block)
+	e.preferred = ""
+	return nil
+}
+
+func (e *Engine) isCandidate(hash string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.candidates[hash]
+	return ok
+}
+
+func (e *Engine) preference() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.preferred
+}
@@ -0,0 +1,120 @@
+package snowman
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tiennampham23/avalanche-consensus-simulator/chain"
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"github.com/tiennampham23/avalanche-consensus-simulator/snow/consensus"
+)
+
+// startEngines starts the chains with the same genesis block
+func startEngines(t *testing.T, ctx context.Context, numOfNodes int) ([]*Engine, *chain.Block) {
+	t.Helper()
+	network := p2p.NewMemoryNetwork()
+	discovery := p2p.InitDiscovery(network.NewTransport("discovery"))
+	if err := discovery.Start(); err != nil {
+		t.Fatal(err)
+	}
+	genesis := chain.NewBlock(nil, []byte("genesis"), 0)
+	engines := make([]*Engine, numOfNodes)
+	for j := range engines {
+		engine, err := NewEngine(consensus.Parameters{
+			K:                   5,
+			Alpha:               4,
+			BetaVirtuous:        3,
+			BetaRogue:           5,
+			ConcurrentRepolls:   1,
+			MaxOutstandingItems: 1,
+		}, int64(j+1), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := chain.InitBlockChainState()
+		if err := state.Add(genesis); err != nil {
+			t.Fatal(err)
+		}
+		engine.SetChain(state)
+		client, err := p2p.InitClient(ctx, p2p.Config{
+			DiscoveryAddress: discovery.Address,
+			Transport:        network.NewTransport(fmt.Sprintf("node-%d", j)),
+		}, func(int) ([]byte, error) {
+			return nil, errors.New("the node serves no block data")
+		}, engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			_ = client.Close()
+		})
+		engine.SetClient(client)
+		engines[j] = engine
+	}
+	return engines, genesis
+}
+
+func TestEngineRejectsTheLosingSibling(t *testing.T) {
+	const numOfNodes = 6
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	engines, genesis := startEngines(t, ctx, numOfNodes)
+	winner := chain.NewBlock(genesis, []byte("winner"), 1)
+	loser := chain.NewBlock(genesis, []byte("loser"), 1)
+	// the last node only knows the losing sibling, it learns the winner from its peers
+	for j, engine := range engines {
+		block := winner
+		if j == numOfNodes-1 {
+			block = loser
+		}
+		payload, err := json.Marshal(PushBlockRequest{Block: block})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := engine.PushBlock(ctx, "node-0", payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs := make(chan error, numOfNodes)
+	for _, engine := range engines {
+		go func(engine *Engine) {
+			errs <- engine.Run(ctx, 1, nil)
+		}(engine)
+	}
+	for range engines {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for j, engine := range engines {
+		tip := engine.state.LastBlock()
+		if tip.BlockHash != winner.BlockHash {
+			t.Errorf("node %d accepted %q, want %q", j, tip.Data, winner.Data)
+		}
+	}
+	last := engines[numOfNodes-1]
+	if last.Rejected() != 1 {
+		t.Errorf("rejected = %d, want the losing sibling to be rejected", last.Rejected())
+	}
+	// the rejected block is neither served nor accepted again
+	payload, err := json.Marshal(GetBlockRequest{Hash: loser.BlockHash})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := last.GetBlock(ctx, "node-0", payload); err == nil {
+		t.Error("the rejected block is still served")
+	}
+	payload, err = json.Marshal(PushBlockRequest{Block: loser})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := last.PushBlock(ctx, "node-0", payload); err == nil {
+		t.Error("the rejected block is a candidate again")
+	}
+}
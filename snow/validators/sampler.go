@@ -0,0 +1,55 @@
+package validators
+
+import (
+	"github.com/tiennampham23/avalanche-consensus-simulator/network/p2p"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Sample leaves out the validators without weight, it is rand.Perm when every validator has the same weight
+func Sample(r *rand.Rand, weights []uint64) []int {
+	uniform := true
+	for _, w := range weights {
+		if w != weights[0] {
+			uniform = false
+			break
+		}
+	}
+	if uniform {
+		if len(weights) == 0 || weights[0] == 0 {
+			return nil
+		}
+		return r.Perm(len(weights))
+	}
+	// Efraimidis and Spirakis: sorting by the key log(u)/w in decreasing order picks the validators proportionally to their weights
+	indices := make([]int, 0, len(weights))
+	keys := make([]float64, len(weights))
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		keys[i] = math.Log(1-r.Float64()) / float64(w)
+		indices = append(indices, i)
+	}
+	sort.SliceStable(indices, func(a, b int) bool {
+		return keys[indices[a]] > keys[indices[b]]
+	})
+	return indices
+}
+
+// SamplePeers leaves out a nil peer
+func SamplePeers(r *rand.Rand, peers []*p2p.Peer) []int {
+	return Sample(r, Weights(peers))
+}
+
+// Weights is 0 for a nil peer
+func Weights(peers []*p2p.Peer) []uint64 {
+	weights := make([]uint64, len(peers))
+	for i, peer := range peers {
+		if peer != nil {
+			weights[i] = peer.Weight
+		}
+	}
+	return weights
+}